@@ -0,0 +1,132 @@
+package search
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// boostedPoint scales and lowers its distance to every target
+type boostedPoint struct {
+	Point
+	factor, boost float64
+}
+
+func (p *boostedPoint) ApplyAffinity(dist float64, target VPTreeItem) float64 {
+	return dist*p.factor - p.boost
+}
+
+type boostedPointDistancer struct {
+}
+
+func (d *boostedPointDistancer) Distance(a, b VPTreeItem) float64 {
+	point := func(item VPTreeItem) *Point {
+		if p, ok := item.(*boostedPoint); ok {
+			return &p.Point
+		}
+		return item.(*Point)
+	}
+	p1, p2 := point(a), point(b)
+	return HaversineEarth(p1.Lat, p1.Lon, p2.Lat, p2.Lon)
+}
+
+// checkScores compares the scores returned by a search with the k lowest
+// scores of every item
+func checkScores(t *testing.T, scores, all []float64, k int) {
+	sort.Float64s(all)
+	if len(scores) != k {
+		t.Fatal("Expected", k, "results, got", len(scores))
+	}
+	for i := range scores {
+		if scores[i] != all[i] {
+			t.Fatal("Result", i, "scored", scores[i], "expected", all[i])
+		}
+	}
+}
+
+func TestVPTreeBoostedSearchMatchesBruteForce(t *testing.T) {
+	var distancer boostedPointDistancer
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 500; i++ {
+		points = append(points, &boostedPoint{
+			Point:  Point{Lat: rand.Float64() * 20, Lon: rand.Float64() * 20},
+			factor: 0.5 + rand.Float64(),
+			boost:  rand.Float64() * 300000})
+	}
+
+	for _, size := range []int{0, 8} {
+		tree := VPTree{
+			Distancer:      &distancer,
+			MaxChildren:    size,
+			AffinityBounds: ScoreBounds{MinFactor: 0.5, MaxBoost: 300000},
+		}
+		tree.SetItems(points)
+		frozen, err := tree.Freeze()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 50; i++ {
+			target := &Point{Lat: rand.Float64() * 20, Lon: rand.Float64() * 20}
+			all := make([]float64, len(points))
+			for j, p := range points {
+				all[j] = p.ApplyAffinity(distancer.Distance(p, target), target)
+			}
+
+			for _, k := range []int{1, 5, 20} {
+				_, scores := tree.Search(target, k)
+				checkScores(t, scores, append([]float64(nil), all...), k)
+
+				_, scores = frozen.Search(target, k)
+				checkScores(t, scores, append([]float64(nil), all...), k)
+			}
+		}
+	}
+}
+
+func TestTreeRescoreBoundsMatchesBruteForce(t *testing.T) {
+	cities := make([]city, 500)
+	for i := range cities {
+		cities[i] = city{Lat: rand.Float64() * 20, Lon: rand.Float64() * 20}
+	}
+
+	// Boost and scale each city by a pseudo random amount derived from its
+	// coordinates
+	rescore := func(c city, dist float64) float64 {
+		h := math.Abs(math.Sin(c.Lat*12.9898+c.Lon*78.233) * 43758.5453)
+		h -= math.Floor(h)
+		return dist*(0.25+h) - h*500000
+	}
+	opts := SearchOptions[city]{
+		Rescore:       rescore,
+		RescoreBounds: ScoreBounds{MinFactor: 0.25, MaxBoost: 500000},
+	}
+
+	for _, size := range []int{0, 8} {
+		tree := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		tree.SetItems(cities)
+
+		for i := 0; i < 50; i++ {
+			target := city{Lat: rand.Float64() * 20, Lon: rand.Float64() * 20}
+			all := make([]float64, len(cities))
+			for j, c := range cities {
+				all[j] = rescore(c, cityDistance(c, target))
+			}
+
+			for _, k := range []int{1, 5, 20} {
+				results, scores, err := tree.SearchContext(context.Background(), target, k, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkScores(t, scores, append([]float64(nil), all...), k)
+				for j, c := range results {
+					if rescore(c, cityDistance(c, target)) != scores[j] {
+						t.Fatal("Returned score", scores[j], "for", c)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// SearchBatch runs Search for every target in parallel. The results and
+// distances for targets[i] are at index i of the returned slices. The work is
+// spread over workers goroutines, runtime.NumCPU() when workers is 0 or less.
+// Each worker reuses its priority queue between searches.
+//
+// Every target is searched under its own read lock, so a change waiting for
+// the write lock is applied between two targets instead of stalling other
+// searches until the whole batch is done. Targets searched after a change see
+// it.
+func (t *Tree[T]) SearchBatch(targets []T, k int, workers int) ([][]T, [][]float64) {
+	results := make([][]T, len(targets))
+	distances := make([][]float64, len(targets))
+	if k <= 0 {
+		for i := range targets {
+			results[i], distances[i] = []T{}, []float64{}
+		}
+		return results, distances
+	}
+
+	t.searchParallel(len(targets), k, workers, func(s *searcher[T], i int) {
+		t.mutex.RLock()
+		defer t.mutex.RUnlock()
+		s.target = targets[i]
+		s.useAffinity()
+		s.search(t.root)
+		t.record(s)
+		results[i], distances[i] = s.results()
+	})
+
+	return results, distances
+}
+
+// searchParallel calls fn for every index below n spread over workers
+// goroutines, runtime.NumCPU() when workers is 0 or less. Each worker passes
+// its own searcher for k results which is reset between calls so its queue is
+// reused. The read lock has to be held around the whole call or taken by fn.
+func (t *Tree[T]) searchParallel(n, k, workers int, fn func(s *searcher[T], i int)) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := t.newSearcher(*new(T), k, math.MaxFloat64)
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				s.tau = s.maxDist
+				s.evals, s.visited, s.pruned, s.dead = 0, 0, 0, 0
+				fn(&s, i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// SearchBatch runs Search for every target in parallel, see Tree.SearchBatch
+func (v *VPTree) SearchBatch(targets []VPTreeItem, k int, workers int) ([][]VPTreeItem, [][]float64) {
+	return v.core().SearchBatch(targets, k, workers)
+}
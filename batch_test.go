@@ -0,0 +1,106 @@
+package search
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestVPTreeSearchBatchMatchesSearch(t *testing.T) {
+	var distancer PointDistancer
+	tree := searchContextTree(&distancer)
+
+	targets := make([]VPTreeItem, 200)
+	for i := range targets {
+		targets[i] = &Point{Lat: rand.Float64() * 29, Lon: rand.Float64() * 29}
+	}
+
+	for _, workers := range []int{0, 1, 3, 1000} {
+		results, distances := tree.SearchBatch(targets, 4, workers)
+		if len(results) != len(targets) || len(distances) != len(targets) {
+			t.Fatal("Expected", len(targets), "result sets, got", len(results))
+		}
+		for i, target := range targets {
+			want, wantDist := tree.Search(target, 4)
+			if len(results[i]) != len(want) {
+				t.Fatal("Expected", len(want), "results, got", len(results[i]))
+			}
+			for j := range want {
+				if distances[i][j] != wantDist[j] {
+					t.Fatal("Target", i, "returned distance", distances[i][j], "expected", wantDist[j])
+				}
+			}
+		}
+	}
+
+	results, distances := tree.SearchBatch(targets[:3], 0, 0)
+	if len(results) != 3 || len(results[0]) != 0 || len(distances[2]) != 0 {
+		t.Fatal("Expected empty results for k 0, got", results)
+	}
+}
+
+func BenchmarkTreeSearchBatch(b *testing.B) {
+	tree := Tree[city]{Distance: cityDistance, MaxChildren: 8}
+	tree.SetItems(gridCities(100))
+
+	targets := make([]city, 1000)
+	for i := range targets {
+		targets[i] = city{Lat: rand.Float64() * 99, Lon: rand.Float64() * 99}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.SearchBatch(targets, 10, 0)
+	}
+}
+
+func TestTreeSearchBatchLetsWritersIn(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	inserted := make(chan struct{})
+	var once sync.Once
+	var afterInsert bool
+
+	tree := Tree[city]{}
+	tree.Distance = func(a, b city) float64 {
+		switch b.Name {
+		case "first":
+			once.Do(func() { close(started) })
+			<-release
+		case "second":
+			select {
+			case <-inserted:
+				afterInsert = true
+			default:
+			}
+		}
+		return cityDistance(a, b)
+	}
+	tree.SetItems(gridCities(5))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tree.SearchBatch([]city{{Name: "first"}, {Name: "second"}}, 1, 1)
+	}()
+
+	<-started
+	go func() {
+		tree.Insert(city{Name: "inserted", Lat: 2.5, Lon: 2.5})
+		close(inserted)
+	}()
+	// Wait until the insert is queued for the write lock, which blocks new
+	// readers, before letting the first search finish
+	for tree.mutex.TryRLock() {
+		tree.mutex.RUnlock()
+		runtime.Gosched()
+	}
+	close(release)
+	<-done
+
+	if !afterInsert {
+		t.Fatal("Insert waited for the whole batch")
+	}
+}
@@ -0,0 +1,221 @@
+package search
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Noise is the cluster label of items that do not belong to any cluster
+const Noise = -1
+
+// unclassified marks items DBSCAN has not reached yet
+const unclassified = -2
+
+// DBSCAN clusters the items by density. Items with at least minPts items,
+// themselves included, closer than eps are core items. Core items closer than
+// eps to each other share a cluster together with the items close to them.
+// The label of the item at index i of Items is at index i of the returned
+// slice, clusters are numbered from 0 and the number of clusters is returned
+// as well. Items in no cluster and items marked for removal are labelled
+// Noise. The neighborhoods are found with radius searches and affinity is not
+// applied.
+func (t *Tree[T]) DBSCAN(eps float64, minPts int) ([]int, int) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	labels := make([]int, len(t.items))
+	for i := range labels {
+		labels[i] = unclassified
+	}
+
+	s := t.newSearcher(*new(T), 0, eps)
+	clusters := 0
+	for i := range t.items {
+		if labels[i] != unclassified {
+			continue
+		}
+		if t.nodes[i]._dead {
+			labels[i] = Noise
+			continue
+		}
+
+		seeds, _ := t.region(&s, i)
+		if len(seeds) < minPts {
+			labels[i] = Noise
+			continue
+		}
+
+		cluster := clusters
+		clusters++
+		labels[i] = cluster
+		for len(seeds) > 0 {
+			j := seeds[len(seeds)-1]
+			seeds = seeds[:len(seeds)-1]
+			if labels[j] == Noise {
+				// A border item reached from a core item
+				labels[j] = cluster
+			}
+			if labels[j] != unclassified {
+				continue
+			}
+			labels[j] = cluster
+			if neighbors, _ := t.region(&s, j); len(neighbors) >= minPts {
+				seeds = append(seeds, neighbors...)
+			}
+		}
+	}
+
+	return labels, clusters
+}
+
+// region returns the indices of the items closer than the searcher's maximum
+// distance to the item at index i and their distances sorted ascending. The
+// item itself is included.
+func (t *Tree[T]) region(s *searcher[T], i int) ([]int, []float64) {
+	s.target = t.items[i]
+	s.tau = s.maxDist
+	s.search(t.root)
+	return s.indices()
+}
+
+// OPTICSResult is the cluster ordering computed by OPTICS
+type OPTICSResult struct {
+	// Order lists the indices of the live items in the order they were
+	// processed, items of a cluster are adjacent
+	Order []int
+	// Reachability is the reachability distance of each item by index in
+	// Items, +Inf when undefined
+	Reachability []float64
+	// CoreDistance is the distance to the minPts-th nearest item of each item
+	// by index in Items, itself included, +Inf when it is not a core item
+	CoreDistance []float64
+}
+
+// OPTICS orders the items by density so clusters for any radius up to eps can
+// be extracted from the result. See DBSCAN for the meaning of eps and minPts.
+func (t *Tree[T]) OPTICS(eps float64, minPts int) OPTICSResult {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	n := len(t.items)
+	result := OPTICSResult{
+		Order:        make([]int, 0, n-len(t._deadIdx)),
+		Reachability: make([]float64, n),
+		CoreDistance: make([]float64, n),
+	}
+	for i := 0; i < n; i++ {
+		result.Reachability[i] = math.Inf(1)
+		result.CoreDistance[i] = math.Inf(1)
+	}
+
+	processed := make([]bool, n)
+	s := t.newSearcher(*new(T), 0, eps)
+	var seeds seedQueue
+
+	// expand adds the item to the ordering and updates the reachability of
+	// its unprocessed neighbors when it is a core item
+	expand := func(i int) {
+		processed[i] = true
+		result.Order = append(result.Order, i)
+
+		neighbors, distances := t.region(&s, i)
+		if minPts < 1 || len(neighbors) < minPts {
+			return
+		}
+		core := distances[minPts-1]
+		result.CoreDistance[i] = core
+
+		for k, j := range neighbors {
+			if processed[j] {
+				continue
+			}
+			reach := math.Max(core, distances[k])
+			if reach < result.Reachability[j] {
+				result.Reachability[j] = reach
+				heap.Push(&seeds, seed{index: j, dist: reach})
+			}
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		if processed[i] || t.nodes[i]._dead {
+			continue
+		}
+		expand(i)
+		for seeds.Len() > 0 {
+			next := heap.Pop(&seeds).(seed)
+			// Seeds are pushed again when their reachability drops, skip the
+			// stale entries
+			if processed[next.index] || next.dist != result.Reachability[next.index] {
+				continue
+			}
+			expand(next.index)
+		}
+	}
+
+	return result
+}
+
+// Labels extracts the clusters for a radius eps no larger than the one OPTICS
+// ran with. The labels match DBSCAN with that radius except that border items
+// reachable from several clusters may be assigned differently.
+func (r OPTICSResult) Labels(eps float64) ([]int, int) {
+	labels := make([]int, len(r.Reachability))
+	for i := range labels {
+		labels[i] = Noise
+	}
+
+	cluster, clusters := Noise, 0
+	for _, i := range r.Order {
+		if r.Reachability[i] > eps {
+			if r.CoreDistance[i] > eps {
+				continue
+			}
+			cluster = clusters
+			clusters++
+		}
+		labels[i] = cluster
+	}
+
+	return labels, clusters
+}
+
+type seed struct {
+	index int
+	dist  float64
+}
+
+// seedQueue is a min-heap of OPTICS seeds by reachability distance
+type seedQueue []seed
+
+func (q seedQueue) Len() int { return len(q) }
+
+func (q seedQueue) Less(i, j int) bool {
+	return q[i].dist < q[j].dist
+}
+
+func (q seedQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *seedQueue) Push(x interface{}) {
+	*q = append(*q, x.(seed))
+}
+
+func (q *seedQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[0 : n-1]
+	return item
+}
+
+// DBSCAN clusters the items by density, see Tree.DBSCAN
+func (v *VPTree) DBSCAN(eps float64, minPts int) ([]int, int) {
+	return v.core().DBSCAN(eps, minPts)
+}
+
+// OPTICS orders the items by density, see Tree.OPTICS
+func (v *VPTree) OPTICS(eps float64, minPts int) OPTICSResult {
+	return v.core().OPTICS(eps, minPts)
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// blobCities returns n cities scattered around each center, at most spread
+// degrees away, followed by isolated cities far from the centers and each
+// other
+func blobCities(centers []city, n int, spread float64, isolated int) []city {
+	cities := make([]city, 0, len(centers)*n+isolated)
+	for c, center := range centers {
+		for i := 0; i < n; i++ {
+			angle := rand.Float64() * 2 * math.Pi
+			r := spread * math.Sqrt(rand.Float64())
+			cities = append(cities, city{
+				Name: centers[c].Name,
+				Lat:  center.Lat + r*math.Sin(angle),
+				Lon:  center.Lon + r*math.Cos(angle)})
+		}
+	}
+	for i := 0; i < isolated; i++ {
+		cities = append(cities, city{Lat: -30 + float64(i)*5, Lon: 100 + float64(i)*3})
+	}
+	return cities
+}
+
+var blobCenters = []city{
+	{Name: "berlin", Lat: 52.52, Lon: 13.40},
+	{Name: "paris", Lat: 48.85, Lon: 2.35},
+	{Name: "new york", Lat: 40.71, Lon: -74.0},
+}
+
+// checkBlobLabels verifies each blob forms its own cluster and the isolated
+// cities are noise
+func checkBlobLabels(t *testing.T, cities []city, labels []int, clusters int) {
+	if clusters != len(blobCenters) {
+		t.Fatal("Expected", len(blobCenters), "clusters, got", clusters)
+	}
+	byName := make(map[string]int)
+	byLabel := make(map[int]string)
+	for i, c := range cities {
+		label := labels[i]
+		if c.Name == "" {
+			if label != Noise {
+				t.Fatal("Isolated city", c, "labelled", label)
+			}
+			continue
+		}
+		if label == Noise {
+			t.Fatal("Blob city", c, "labelled noise")
+		}
+		if l, ok := byName[c.Name]; ok && l != label {
+			t.Fatal("Blob", c.Name, "split into clusters", l, "and", label)
+		}
+		if n, ok := byLabel[label]; ok && n != c.Name {
+			t.Fatal("Blobs", n, "and", c.Name, "merged into cluster", label)
+		}
+		byName[c.Name] = label
+		byLabel[label] = c.Name
+	}
+}
+
+func TestTreeDBSCAN(t *testing.T) {
+	cities := blobCities(blobCenters, 60, 0.01, 10)
+	tree := Tree[city]{Distance: cityDistance, MaxChildren: 8}
+	tree.SetItems(cities)
+
+	labels, clusters := tree.DBSCAN(1000, 5)
+	checkBlobLabels(t, cities, labels, clusters)
+
+	// Too few neighbors within the radius to form any cluster
+	labels, clusters = tree.DBSCAN(1, 5)
+	if clusters != 0 {
+		t.Fatal("Expected no clusters, got", clusters)
+	}
+	for i, label := range labels {
+		if label != Noise {
+			t.Fatal("City", i, "labelled", label)
+		}
+	}
+}
+
+func TestTreeOPTICS(t *testing.T) {
+	cities := blobCities(blobCenters, 60, 0.01, 10)
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(cities)
+
+	result := tree.OPTICS(5000, 5)
+	if len(result.Order) != len(cities) {
+		t.Fatal("Expected", len(cities), "ordered items, got", len(result.Order))
+	}
+	labels, clusters := result.Labels(1000)
+	checkBlobLabels(t, cities, labels, clusters)
+
+	want, _ := tree.DBSCAN(1000, 5)
+	for i := range want {
+		if (want[i] == Noise) != (labels[i] == Noise) {
+			t.Fatal("City", i, "labelled", labels[i], "DBSCAN labelled", want[i])
+		}
+	}
+
+	// Every blob city but the first of each cluster is reachable
+	reachable := 0
+	for _, i := range result.Order {
+		if !math.IsInf(result.Reachability[i], 1) {
+			reachable++
+		}
+	}
+	if reachable != len(cities)-10-len(blobCenters) {
+		t.Fatal("Expected", len(cities)-10-len(blobCenters), "reachable cities, got", reachable)
+	}
+}
+
+func TestVPTreeDBSCANRemoved(t *testing.T) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+
+	points := make([]VPTreeItem, 0)
+	for _, c := range blobCities(blobCenters[:1], 6, 0.001, 0) {
+		points = append(points, &Point{Lat: c.Lat, Lon: c.Lon})
+	}
+	tree.SetItems(points)
+
+	labels, clusters := tree.DBSCAN(500, 6)
+	if clusters != 1 || labels[0] != 0 {
+		t.Fatal("Expected one cluster, got", clusters, labels)
+	}
+
+	// Removing one point leaves too few for minPts
+	tree.Remove(points[0])
+	labels, clusters = tree.DBSCAN(500, 6)
+	if clusters != 0 {
+		t.Fatal("Expected no clusters, got", clusters, labels)
+	}
+	for i, label := range labels {
+		if label != Noise {
+			t.Fatal("Point", i, "labelled", label)
+		}
+	}
+
+	result := tree.OPTICS(500, 5)
+	if len(result.Order) != 5 {
+		t.Fatal("Removed point ordered", result.Order)
+	}
+}
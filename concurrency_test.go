@@ -0,0 +1,150 @@
+package search
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// TestVPTreeConcurrentReadWrite hammers a tree with searches while items are
+// inserted, removed and the index is rebuilt. Run with -race.
+func TestVPTreeConcurrentReadWrite(t *testing.T) {
+	for _, size := range []int{0, 8} {
+		testVPTreeConcurrentReadWrite(t, size)
+	}
+}
+
+func testVPTreeConcurrentReadWrite(t *testing.T, maxChildren int) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+	tree.MaxChildren = maxChildren
+
+	// Anchors are never removed so every search for one must find it
+	anchors := make([]*Point, 0)
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			p := &Point{Lat: float64(i), Lon: float64(j)}
+			anchors = append(anchors, p)
+			points = append(points, p)
+		}
+	}
+	tree.SetItems(points)
+
+	var readers, writers sync.WaitGroup
+	done := make(chan struct{})
+
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func(seed int64) {
+			defer readers.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				anchor := anchors[rnd.Intn(len(anchors))]
+				target := &Point{Lat: anchor.Lat, Lon: anchor.Lon}
+
+				results, distances := tree.Search(target, 1)
+				if len(results) != 1 || distances[0] != 0 {
+					t.Error("Anchor not found", anchor, results, distances)
+					return
+				}
+				results, _, err := tree.SearchContext(context.Background(), target, 3, SearchOptions[VPTreeItem]{})
+				if err != nil || len(results) != 3 {
+					t.Error("SearchContext failed", err, len(results))
+					return
+				}
+				if n := tree.CountInRadius(target, 1); n < 1 {
+					t.Error("Anchor not counted", anchor)
+					return
+				}
+				tree.SearchRadius(target, 150000)
+				tree.ItemCount()
+			}
+		}(int64(r))
+	}
+
+	inserted := make(chan *Point, 1000)
+	for w := 0; w < 2; w++ {
+		writers.Add(1)
+		go func(seed int64) {
+			defer writers.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 300; i++ {
+				p := &Point{
+					Lat: 0.5 + rnd.Float64()*18,
+					Lon: 0.5 + rnd.Float64()*18}
+				tree.Insert(p)
+				inserted <- p
+			}
+		}(int64(100 + w))
+	}
+
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for i := 0; i < 200; i++ {
+			tree.Remove(<-inserted)
+		}
+	}()
+
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for i := 0; i < 5; i++ {
+			tree.Rebuild()
+			<-tree.RebuildAsync()
+		}
+	}()
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	tree.Rebuild()
+	if n := tree.ItemCount(); n != len(anchors)+400 {
+		t.Fatal("Expected", len(anchors)+400, "items after rebuild, got", n)
+	}
+}
+
+func TestTreeConcurrentReadWrite(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance, MaxChildren: 4}
+	tree.SetItems(gridCities(10))
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				target := city{Lat: float64(i % 10), Lon: float64(i / 20)}
+				results, distances := tree.Search(target, 1)
+				if len(results) != 1 || distances[0] != 0 {
+					t.Error("Grid city not found", target)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			c := city{Name: "new", Lat: rand.Float64() * 9, Lon: rand.Float64() * 9}
+			tree.Insert(c)
+			if i%3 == 0 {
+				tree.Remove(c)
+			}
+			if i%50 == 0 {
+				tree.Rebuild()
+			}
+		}
+	}()
+	wg.Wait()
+}
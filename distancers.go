@@ -0,0 +1,197 @@
+package search
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Euclidean returns the straight line distance between two vectors. Missing
+// values of the shorter vector are treated as 0.
+func Euclidean(x, y []float64) float64 {
+	sum := 0.0
+	forEachPair(x, y, func(a, b float64) {
+		sum += (a - b) * (a - b)
+	})
+	return math.Sqrt(sum)
+}
+
+// Manhattan returns the sum of the absolute differences between two vectors.
+// Missing values of the shorter vector are treated as 0.
+func Manhattan(x, y []float64) float64 {
+	sum := 0.0
+	forEachPair(x, y, func(a, b float64) {
+		sum += math.Abs(a - b)
+	})
+	return sum
+}
+
+// Chebyshev returns the largest absolute difference between two vectors.
+// Missing values of the shorter vector are treated as 0.
+func Chebyshev(x, y []float64) float64 {
+	max := 0.0
+	forEachPair(x, y, func(a, b float64) {
+		max = math.Max(max, math.Abs(a-b))
+	})
+	return max
+}
+
+// Angular returns the angle between two vectors scaled to [0, 1], 1 being
+// opposite directions. Unlike the cosine distance it satisfies the triangle
+// inequality. A zero vector is at a right angle, 0.5, to every other vector.
+func Angular(x, y []float64) float64 {
+	var dot, nx, ny float64
+	forEachPair(x, y, func(a, b float64) {
+		dot += a * b
+		nx += a * a
+		ny += b * b
+	})
+	if nx == 0 || ny == 0 {
+		if nx == ny {
+			return 0
+		}
+		return 0.5
+	}
+	cos := dot / math.Sqrt(nx*ny)
+	// Rounding can leave the cosine just outside its range
+	cos = math.Max(-1, math.Min(1, cos))
+	return math.Acos(cos) / math.Pi
+}
+
+// forEachPair calls fn with the values at each position of the longer of
+// two vectors, missing values are 0
+func forEachPair(x, y []float64, fn func(a, b float64)) {
+	n := len(x)
+	if len(y) > n {
+		n = len(y)
+	}
+	for i := 0; i < n; i++ {
+		var a, b float64
+		if i < len(x) {
+			a = x[i]
+		}
+		if i < len(y) {
+			b = y[i]
+		}
+		fn(a, b)
+	}
+}
+
+// Hamming64 returns the number of bits that differ between two words
+func Hamming64(x, y uint64) float64 {
+	return float64(bits.OnesCount64(x ^ y))
+}
+
+// HammingBits returns the number of bits that differ between two bitsets.
+// Missing words of the shorter bitset are treated as 0.
+func HammingBits(x, y []uint64) float64 {
+	if len(x) < len(y) {
+		x, y = y, x
+	}
+	count := 0
+	for i, w := range x {
+		if i < len(y) {
+			w ^= y[i]
+		}
+		count += bits.OnesCount64(w)
+	}
+	return float64(count)
+}
+
+// Jaccard returns one minus the size of the intersection over the size of the
+// union of two sets. Two empty sets are at distance 0.
+func Jaccard[K comparable](x, y map[K]struct{}) float64 {
+	if len(x) > len(y) {
+		x, y = y, x
+	}
+	shared := 0
+	for m := range x {
+		if _, ok := y[m]; ok {
+			shared++
+		}
+	}
+	union := len(x) + len(y) - shared
+	if union == 0 {
+		return 0
+	}
+	return 1 - float64(shared)/float64(union)
+}
+
+// EuclideanDistancer compares Vector items by Euclidean distance
+type EuclideanDistancer struct {
+}
+
+// Distance returns the Euclidean distance between two Vector items
+func (d *EuclideanDistancer) Distance(a, b VPTreeItem) float64 {
+	return Euclidean(a.(*Vector).Values, b.(*Vector).Values)
+}
+
+// ManhattanDistancer compares Vector items by Manhattan distance
+type ManhattanDistancer struct {
+}
+
+// Distance returns the Manhattan distance between two Vector items
+func (d *ManhattanDistancer) Distance(a, b VPTreeItem) float64 {
+	return Manhattan(a.(*Vector).Values, b.(*Vector).Values)
+}
+
+// ChebyshevDistancer compares Vector items by Chebyshev distance
+type ChebyshevDistancer struct {
+}
+
+// Distance returns the Chebyshev distance between two Vector items
+func (d *ChebyshevDistancer) Distance(a, b VPTreeItem) float64 {
+	return Chebyshev(a.(*Vector).Values, b.(*Vector).Values)
+}
+
+// AngularDistancer compares Vector items by the angle between them
+type AngularDistancer struct {
+}
+
+// Distance returns the angular distance between two Vector items
+func (d *AngularDistancer) Distance(a, b VPTreeItem) float64 {
+	return Angular(a.(*Vector).Values, b.(*Vector).Values)
+}
+
+// HaversineDistancer compares LatLon items by their distance in meters on a
+// sphere the size of the earth
+type HaversineDistancer struct {
+}
+
+// Distance returns the haversine distance between two LatLon items
+func (d *HaversineDistancer) Distance(a, b VPTreeItem) float64 {
+	p1, p2 := a.(*LatLon), b.(*LatLon)
+	return HaversineEarth(p1.Lat, p1.Lon, p2.Lat, p2.Lon)
+}
+
+// VincentyDistancer compares LatLon items by their distance in meters on the
+// WGS-84 ellipsoid. It is more accurate but slower than HaversineDistancer.
+type VincentyDistancer struct {
+}
+
+// Distance returns the Vincenty distance between two LatLon items
+func (d *VincentyDistancer) Distance(a, b VPTreeItem) float64 {
+	p1, p2 := a.(*LatLon), b.(*LatLon)
+	return VincentyDistance(p1.Lat, p1.Lon, p2.Lat, p2.Lon)
+}
+
+// HammingDistancer compares Hash64 or Bitset items by the number of bits that
+// differ. A tree has to hold only one of the two types.
+type HammingDistancer struct {
+}
+
+// Distance returns the Hamming distance between two Hash64 or Bitset items
+func (d *HammingDistancer) Distance(a, b VPTreeItem) float64 {
+	if h, ok := a.(*Hash64); ok {
+		return Hamming64(h.Hash, b.(*Hash64).Hash)
+	}
+	return HammingBits(a.(*Bitset).Bits, b.(*Bitset).Bits)
+}
+
+// JaccardDistancer compares Set items by Jaccard distance
+type JaccardDistancer[K comparable] struct {
+}
+
+// Distance returns the Jaccard distance between two Set items
+func (d *JaccardDistancer[K]) Distance(a, b VPTreeItem) float64 {
+	return Jaccard(a.(*Set[K]).Members, b.(*Set[K]).Members)
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDistanceFunctions(t *testing.T) {
+	x, y := []float64{1, 2, 3}, []float64{4, 6, 3}
+	cases := []struct {
+		name      string
+		got, want float64
+	}{
+		{"Euclidean", Euclidean(x, y), 5},
+		{"Manhattan", Manhattan(x, y), 7},
+		{"Chebyshev", Chebyshev(x, y), 4},
+		{"Euclidean missing values", Euclidean([]float64{3, 4}, nil), 5},
+		{"Angular same direction", Angular([]float64{1, 1}, []float64{2, 2}), 0},
+		{"Angular right angle", Angular([]float64{1, 0}, []float64{0, 3}), 0.5},
+		{"Angular opposite", Angular([]float64{1, 0}, []float64{-1, 0}), 1},
+		{"Angular zero vector", Angular([]float64{0, 0}, []float64{1, 0}), 0.5},
+		{"Hamming64", Hamming64(0xF0, 0x0F), 8},
+		{"HammingBits", HammingBits([]uint64{1, 3}, []uint64{0}), 3},
+		{"Jaccard", Jaccard(NewSet("a", "b", "c").Members, NewSet("b", "c", "d").Members), 0.5},
+		{"Jaccard empty", Jaccard(NewSet[string]().Members, NewSet[string]().Members), 0},
+	}
+	for _, c := range cases {
+		if math.Abs(c.got-c.want) > 1e-12 {
+			t.Fatal(c.name, "returned", c.got, "expected", c.want)
+		}
+	}
+}
+
+func TestDistanceFunctionsTriangleInequality(t *testing.T) {
+	vector := func() []float64 {
+		v := make([]float64, 1+rand.Intn(4))
+		for i := range v {
+			v[i] = rand.NormFloat64()
+		}
+		return v
+	}
+	metrics := map[string]func(x, y []float64) float64{
+		"Euclidean": Euclidean,
+		"Manhattan": Manhattan,
+		"Chebyshev": Chebyshev,
+		"Angular":   Angular,
+	}
+	for name, metric := range metrics {
+		for i := 0; i < 1000; i++ {
+			x, y, z := vector(), vector(), vector()
+			if metric(x, z) > metric(x, y)+metric(y, z)+1e-6 {
+				t.Fatal(name, "violates the triangle inequality for", x, y, z)
+			}
+			if metric(x, y) != metric(y, x) {
+				t.Fatal(name, "is not symmetric for", x, y)
+			}
+		}
+	}
+}
+
+func TestDistancersInVPTree(t *testing.T) {
+	vectors := func() []VPTreeItem {
+		items := make([]VPTreeItem, 200)
+		for i := range items {
+			items[i] = NewVector(rand.Float64(), rand.Float64(), rand.Float64())
+		}
+		return items
+	}
+	coordinates := func() []VPTreeItem {
+		items := make([]VPTreeItem, 200)
+		for i := range items {
+			items[i] = NewLatLon(rand.Float64()*10, rand.Float64()*10)
+		}
+		return items
+	}
+
+	cases := []struct {
+		name      string
+		distancer VPTreeDistancer
+		items     []VPTreeItem
+	}{
+		{"Euclidean", &EuclideanDistancer{}, vectors()},
+		{"Manhattan", &ManhattanDistancer{}, vectors()},
+		{"Chebyshev", &ChebyshevDistancer{}, vectors()},
+		{"Angular", &AngularDistancer{}, vectors()},
+		{"Haversine", &HaversineDistancer{}, coordinates()},
+		{"Vincenty", &VincentyDistancer{}, coordinates()},
+		{"Hamming", &HammingDistancer{}, []VPTreeItem{
+			NewHash64(0), NewHash64(1), NewHash64(0xFF), NewHash64(0xFFFF), NewHash64(math.MaxUint64)}},
+		{"Hamming bitset", &HammingDistancer{}, []VPTreeItem{
+			NewBitset(0), NewBitset(1, 1), NewBitset(0xFF, 0xFF), NewBitset(0, 0, 7)}},
+		{"Jaccard", &JaccardDistancer[string]{}, []VPTreeItem{
+			NewSet("fuel"), NewSet("fuel", "food"), NewSet("food", "parking"), NewSet("parking")}},
+	}
+
+	for _, c := range cases {
+		tree := VPTree{Distancer: c.distancer, MaxChildren: 4}
+		tree.SetItems(c.items)
+		for _, item := range c.items {
+			results, distances := tree.Search(item, 1)
+			if len(results) != 1 || distances[0] != 0 {
+				t.Fatal(c.name, "item not found", item)
+			}
+			if item.GetNode() == nil {
+				t.Fatal(c.name, "item not bound to a node")
+			}
+		}
+		tree.Remove(c.items[0])
+		if results, _ := tree.Search(c.items[0], 1); results[0] == c.items[0] {
+			t.Fatal(c.name, "removed item returned")
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"math"
+)
+
+// Levenshtein returns the number of single character insertions, deletions
+// and substitutions needed to turn a into b
+func Levenshtein(a, b string) int {
+	return LevenshteinBounded(a, b, math.MaxInt)
+}
+
+// LevenshteinBounded returns Levenshtein(a, b) when it is at most limit,
+// otherwise limit+1. It stops as soon as every path through the remaining
+// characters exceeds the limit.
+func LevenshteinBounded(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	// The length difference alone takes that many edits
+	if len(ra)-len(rb) > limit {
+		return limit + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	row := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		row[0] = i
+		min := row[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			row[j] = minInt(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if row[j] < min {
+				min = row[j]
+			}
+		}
+		// Row minimums never decrease
+		if min > limit {
+			return limit + 1
+		}
+		prev, row = row, prev
+	}
+
+	if d := prev[len(rb)]; d <= limit {
+		return d
+	}
+	return limit + 1
+}
+
+// DamerauLevenshtein returns the number of single character insertions,
+// deletions, substitutions and transpositions of two adjacent characters
+// needed to turn a into b. Unlike the optimal string alignment distance
+// characters can be edited again after a transposition, so it satisfies the
+// triangle inequality.
+func DamerauLevenshtein(a, b string) int {
+	return DamerauLevenshteinBounded(a, b, math.MaxInt)
+}
+
+// DamerauLevenshteinBounded returns DamerauLevenshtein(a, b) when it is at
+// most limit, otherwise limit+1. It stops as soon as every path through the
+// remaining characters exceeds the limit.
+func DamerauLevenshteinBounded(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	n, m := len(ra), len(rb)
+	if n-m > limit || m-n > limit {
+		return limit + 1
+	}
+
+	// d is offset by one so d[0] holds the maximum distance sentinel row
+	maxDist := n + m
+	d := make([][]int, n+2)
+	for i := range d {
+		d[i] = make([]int, m+2)
+	}
+	d[0][0] = maxDist
+	for i := 0; i <= n; i++ {
+		d[i+1][0] = maxDist
+		d[i+1][1] = i
+	}
+	for j := 0; j <= m; j++ {
+		d[0][j+1] = maxDist
+		d[1][j+1] = j
+	}
+
+	// last holds the last row each character of a was seen in
+	last := make(map[rune]int)
+	for i := 1; i <= n; i++ {
+		lastMatch := 0
+		min := d[i+1][1]
+		for j := 1; j <= m; j++ {
+			i1 := last[rb[j-1]]
+			j1 := lastMatch
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+				lastMatch = j
+			}
+			d[i+1][j+1] = minInt(
+				d[i][j]+cost,
+				d[i+1][j]+1,
+				d[i][j+1]+1,
+				d[i1][j1]+(i-i1-1)+1+(j-j1-1))
+			if d[i+1][j+1] < min {
+				min = d[i+1][j+1]
+			}
+		}
+		// A transposition only reaches back to rows no smaller than the
+		// rows skipped, so row minimums never decrease
+		if min > limit {
+			return limit + 1
+		}
+		last[ra[i-1]] = i
+	}
+
+	if dist := d[n+1][m+1]; dist <= limit {
+		return dist
+	}
+	return limit + 1
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// editLimit converts a search limit to the largest whole number of edits
+// within it
+func editLimit(limit float64) int {
+	if limit >= math.MaxInt32 {
+		return math.MaxInt
+	}
+	return int(math.Floor(limit))
+}
+
+// LevenshteinDistancer compares Text items by Levenshtein distance
+type LevenshteinDistancer struct {
+}
+
+// Distance returns the Levenshtein distance between two Text items
+func (d *LevenshteinDistancer) Distance(a, b VPTreeItem) float64 {
+	return float64(Levenshtein(a.(*Text).Value, b.(*Text).Value))
+}
+
+// BoundedDistance returns the Levenshtein distance between two Text items,
+// stopping once it exceeds limit
+func (d *LevenshteinDistancer) BoundedDistance(a, b VPTreeItem, limit float64) float64 {
+	return float64(LevenshteinBounded(a.(*Text).Value, b.(*Text).Value, editLimit(limit)))
+}
+
+// DamerauLevenshteinDistancer compares Text items by Damerau-Levenshtein
+// distance
+type DamerauLevenshteinDistancer struct {
+}
+
+// Distance returns the Damerau-Levenshtein distance between two Text items
+func (d *DamerauLevenshteinDistancer) Distance(a, b VPTreeItem) float64 {
+	return float64(DamerauLevenshtein(a.(*Text).Value, b.(*Text).Value))
+}
+
+// BoundedDistance returns the Damerau-Levenshtein distance between two Text
+// items, stopping once it exceeds limit
+func (d *DamerauLevenshteinDistancer) BoundedDistance(a, b VPTreeItem, limit float64) float64 {
+	return float64(DamerauLevenshteinBounded(a.(*Text).Value, b.(*Text).Value, editLimit(limit)))
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestEditDistances(t *testing.T) {
+	cases := []struct {
+		a, b                 string
+		levenshtein, damerau int
+	}{
+		{"", "", 0, 0},
+		{"", "abc", 3, 3},
+		{"kitten", "sitting", 3, 3},
+		{"ab", "ba", 2, 1},
+		// Optimal string alignment would give 3, a transposed pair can be
+		// edited again
+		{"ca", "abc", 3, 2},
+		{"flaw", "lawn", 2, 2},
+		{"straße", "strasse", 2, 2},
+	}
+	for _, c := range cases {
+		if d := Levenshtein(c.a, c.b); d != c.levenshtein {
+			t.Fatal("Levenshtein", c.a, c.b, "returned", d, "expected", c.levenshtein)
+		}
+		if d := DamerauLevenshtein(c.a, c.b); d != c.damerau {
+			t.Fatal("DamerauLevenshtein", c.a, c.b, "returned", d, "expected", c.damerau)
+		}
+	}
+}
+
+func randomWord(alphabet string, max int) string {
+	word := make([]byte, rand.Intn(max+1))
+	for i := range word {
+		word[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(word)
+}
+
+func TestEditDistancesBoundedAndMetric(t *testing.T) {
+	metrics := map[string]struct {
+		exact   func(a, b string) int
+		bounded func(a, b string, limit int) int
+	}{
+		"Levenshtein":        {Levenshtein, LevenshteinBounded},
+		"DamerauLevenshtein": {DamerauLevenshtein, DamerauLevenshteinBounded},
+	}
+	for name, m := range metrics {
+		for i := 0; i < 2000; i++ {
+			x, y, z := randomWord("abc", 8), randomWord("abc", 8), randomWord("abc", 8)
+			d := m.exact(x, y)
+			if d != m.exact(y, x) {
+				t.Fatal(name, "is not symmetric for", x, y)
+			}
+			if m.exact(x, z) > d+m.exact(y, z) {
+				t.Fatal(name, "violates the triangle inequality for", x, y, z)
+			}
+
+			limit := rand.Intn(6)
+			bounded := m.bounded(x, y, limit)
+			if (d <= limit && bounded != d) || (d > limit && bounded != limit+1) {
+				t.Fatal(name, "bounded by", limit, "returned", bounded, "for", x, y, "at", d)
+			}
+		}
+	}
+}
+
+func TestTreeBoundedDistanceMatchesSearch(t *testing.T) {
+	words := make([]string, 500)
+	for i := range words {
+		words[i] = randomWord("abcdef", 10)
+	}
+	distance := func(a, b string) float64 {
+		return float64(DamerauLevenshtein(a, b))
+	}
+
+	exact := Tree[string]{Distance: distance, MaxChildren: 6}
+	exact.SetItems(words)
+	bounded := Tree[string]{Distance: distance, MaxChildren: 6}
+	bounded.BoundedDistance = func(a, b string, limit float64) float64 {
+		return float64(DamerauLevenshteinBounded(a, b, editLimit(limit)))
+	}
+	bounded.SetItems(words)
+
+	for i := 0; i < 200; i++ {
+		query := randomWord("abcdef", 10)
+		for _, k := range []int{1, 5} {
+			_, want := exact.Search(query, k)
+			_, got := bounded.Search(query, k)
+			if len(got) != len(want) {
+				t.Fatal("Expected", len(want), "results, got", len(got))
+			}
+			for j := range want {
+				if got[j] != want[j] {
+					t.Fatal("Result", j, "for", query, "at", got[j], "expected", want[j])
+				}
+			}
+		}
+	}
+}
+
+func TestStringIndexFuzzy(t *testing.T) {
+	products := []string{
+		"espresso machine", "expresso cups", "coffee grinder", "coffee filter",
+		"tea kettle", "teapot", "milk frother", "french press", "moka pot",
+	}
+
+	for _, transpositions := range []bool{false, true} {
+		index := StringIndex{Transpositions: transpositions, MaxChildren: 3}
+		index.SetStrings(products)
+
+		values, edits := index.Fuzzy("cofee grinder", 2, 3)
+		if len(values) != 1 || values[0] != "coffee grinder" || edits[0] != 1 {
+			t.Fatal("Fuzzy returned", values, edits)
+		}
+
+		// A transposition is one edit with Damerau-Levenshtein
+		values, edits = index.Fuzzy("tea ketlte", 1, 0)
+		if transpositions != (len(values) == 1) {
+			t.Fatal("Fuzzy returned", values, edits, "with transpositions", transpositions)
+		}
+
+		values, edits = index.Fuzzy("espresso", 10, 0)
+		if !sort.IntsAreSorted(edits) || len(values) < 2 || values[0] != "expresso cups" {
+			t.Fatal("Fuzzy returned", values, edits)
+		}
+		for i, v := range values {
+			if edits[i] > 10 || (!transpositions && edits[i] != Levenshtein(v, "espresso")) {
+				t.Fatal("Fuzzy returned", v, "at", edits[i], "edits")
+			}
+		}
+
+		index.Insert("tea strainer")
+		if values, _ := index.Fuzzy("tea strainr", 1, 1); len(values) != 1 {
+			t.Fatal("Inserted value not found")
+		}
+		if !index.Remove("teapot") || index.Remove("teapot") || index.Remove("mug") {
+			t.Fatal("Remove reported the wrong result")
+		}
+		if values, _ := index.Fuzzy("teapot", 0, 1); len(values) != 0 {
+			t.Fatal("Removed value returned", values)
+		}
+		if index.ItemCount() != len(products)+1 {
+			t.Fatal("Expected", len(products)+1, "strings, got", index.ItemCount())
+		}
+	}
+}
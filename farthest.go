@@ -0,0 +1,115 @@
+package search
+
+import (
+	"container/heap"
+)
+
+// SearchFarthest returns the k items farthest from the target sorted by
+// distance descending. The second parameter is the respective distances to
+// the target. Affinity is not applied.
+func (t *Tree[T]) SearchFarthest(target T, k int) ([]T, []float64) {
+	if k <= 0 {
+		return []T{}, []float64{}
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	s := farthestSearcher[T]{tree: t, target: target, k: k}
+	s.search(t.root)
+
+	return s.results()
+}
+
+// farthestSearcher holds the state of a single farthest neighbor search. The
+// queue holds negated distances so its head is the closest of the k kept.
+type farthestSearcher[T any] struct {
+	tree   *Tree[T]
+	target T
+	k      int
+	pq     PriorityQueue
+	// tau is the distance of the closest item kept once k are found
+	tau float64
+}
+
+// full reports if k items are kept, from then on only farther items matter
+func (s *farthestSearcher[T]) full() bool {
+	return s.pq.Len() == s.k
+}
+
+// search visits the subtree below node. Every item in a subtree lies at most
+// the vantage point distance plus the subtree's upper bound, M for the right
+// subtree and leaf children and threshold for the left subtree, away from the
+// target.
+func (s *farthestSearcher[T]) search(node *VPTreeNode) {
+	if node == nil {
+		return
+	}
+
+	dist := s.offer(node)
+
+	if node.isLeaf {
+		if s.full() && dist+node.M <= s.tau {
+			return
+		}
+		for _, idx := range node.children {
+			s.offer(s.tree.nodes[idx])
+		}
+		return
+	}
+
+	if !s.full() || dist+node.M > s.tau {
+		s.search(node.right)
+	}
+	if !s.full() || dist+node.threshold > s.tau {
+		s.search(node.left)
+	}
+}
+
+// offer calculates the distance from the node's item to the target and keeps
+// the item when it is among the k farthest. It returns the distance.
+func (s *farthestSearcher[T]) offer(node *VPTreeNode) float64 {
+	t := s.tree
+	dist := t.Distance(t.items[node.index], s.target)
+	if node._dead || (t.skip != nil && t.skip(t.items[node.index], s.target)) {
+		return dist
+	}
+	if s.full() && dist <= s.tau {
+		return dist
+	}
+
+	pq := &s.pq
+	if s.full() {
+		heap.Pop(pq)
+	}
+	heap.Push(pq, &vpHeapItem{
+		index: node.index,
+		dist:  -dist,
+		node:  node})
+	if s.full() {
+		s.tau = -(*pq)[0].Priority()
+	}
+
+	return dist
+}
+
+// results drains the queue into items and distances sorted descending
+func (s *farthestSearcher[T]) results() ([]T, []float64) {
+	pq := &s.pq
+	results := make([]T, pq.Len())
+	distances := make([]float64, pq.Len())
+
+	for i := pq.Len() - 1; i >= 0; i-- {
+		item := heap.Pop(pq).(*vpHeapItem)
+		results[i] = s.tree.items[item.index]
+		distances[i] = -item.Priority()
+	}
+
+	return results, distances
+}
+
+// SearchFarthest returns the k items farthest from the target sorted by
+// distance descending, see Tree.SearchFarthest
+func (v *VPTree) SearchFarthest(target VPTreeItem, k int) ([]VPTreeItem, []float64) {
+	return v.core().SearchFarthest(target, k)
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTreeSearchFarthestMatchesBruteForce(t *testing.T) {
+	for _, size := range []int{0, 6} {
+		tree := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		cities := gridCities(12)
+		tree.SetItems(cities)
+		for i := 0; i < 30; i++ {
+			tree.Insert(city{Lat: rand.Float64() * 11, Lon: rand.Float64() * 11})
+		}
+		// The farthest corner from the targets below
+		tree.Remove(cities[len(cities)-1])
+
+		for _, target := range []city{{Lat: 0, Lon: 0}, {Lat: 5.5, Lon: 3.2}, {Lat: 20, Lon: -4}} {
+			want := make([]float64, 0)
+			for i, c := range tree.Items() {
+				if !tree.nodes[i]._dead {
+					want = append(want, cityDistance(c, target))
+				}
+			}
+			sort.Sort(sort.Reverse(sort.Float64Slice(want)))
+
+			for _, k := range []int{1, 5, 40} {
+				results, distances := tree.SearchFarthest(target, k)
+				if len(results) != k || len(distances) != k {
+					t.Fatal("Expected", k, "results, got", len(results))
+				}
+				for i := range distances {
+					if distances[i] != want[i] {
+						t.Fatal("Result", i, "at", distances[i], "expected", want[i])
+					}
+					if cityDistance(results[i], target) != distances[i] {
+						t.Fatal("Returned distance", distances[i], "for", results[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestVPTreeSearchFarthest(t *testing.T) {
+	var distancer PointDistancer
+	tree := searchContextTree(&distancer)
+
+	results, distances := tree.SearchFarthest(&Point{Lat: 0, Lon: 0}, 1)
+	if len(results) != 1 {
+		t.Fatal("Expected 1 result, got", len(results))
+	}
+	if p := results[0].(*Point); p.Lat != 29 || p.Lon != 29 || distances[0] == 0 {
+		t.Fatal("Returned", p, "expected the opposite corner")
+	}
+
+	results, _ = tree.SearchFarthest(&Point{}, 0)
+	if len(results) != 0 {
+		t.Fatal("Expected no results for k 0, got", len(results))
+	}
+	results, _ = tree.SearchFarthest(&Point{}, 2000)
+	if len(results) != tree.ItemCount() {
+		t.Fatal("Expected every item, got", len(results))
+	}
+}
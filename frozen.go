@@ -0,0 +1,468 @@
+package search
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"unsafe"
+)
+
+// Node files start with a magic header followed by the format version, node
+// count, root position and leaf children count. The header keeps the nodes 8
+// byte aligned when the file is mapped. The nodes are followed by the leaf
+// children.
+const (
+	frozenMagic         = "VPFN"
+	frozenFormatVersion = uint32(1)
+	frozenHeaderSize    = 24
+	flatNodeSize        = int(unsafe.Sizeof(flatNode{}))
+)
+
+const (
+	flatNodeDead uint32 = 1 << iota
+	flatNodeLeaf
+)
+
+// flatChildDead marks a dead entry in the leaf children array
+const flatChildDead uint32 = 1 << 31
+
+// ErrTreeTooLarge is returned by Freeze for a tree with more nodes than a node
+// file can address
+var ErrTreeTooLarge = errors.New("search: tree too large to freeze")
+
+// flatNode is the fixed size, pointer free representation of a VPTreeNode.
+// Children are referenced by their position in the node array, -1 when
+// absent. For leaf buckets left and right instead hold the start and length of
+// the bucket in the children array. The memory layout matches the little
+// endian file encoding.
+type flatNode struct {
+	threshold, m, M float64
+	index           uint32
+	left, right     int32
+	flags           uint32
+}
+
+// FrozenTree is a read-only vp-tree stored as a flat array of nodes. It can be
+// written to a node file and memory mapped by OpenFrozenTree so several
+// processes share one index without any heap allocations for the nodes. The
+// items themselves are provided by the caller in the same order as the Items
+// of the tree that was frozen.
+type FrozenTree[T any] struct {
+	// Distance returns the distance between two items satisfying the triangle
+	// inequality
+	Distance func(a, b T) float64
+	// AffinityBounds declares how far the affinity may lower a score below
+	// the distance, see VPTree.AffinityBounds
+	AffinityBounds ScoreBounds
+	nodes          []flatNode
+	children       []uint32
+	root           int32
+	items          []T
+	unmap          func() error
+
+	skip     func(item, target T) bool
+	affinity func(dist float64, item, target T) float64
+}
+
+// Freeze returns a read-only copy of the tree's current structure. The items
+// slice is shared with the tree. Node positions and item indices are stored in
+// 32 bits, trees with more than math.MaxInt32 nodes return ErrTreeTooLarge.
+func (t *Tree[T]) Freeze() (*FrozenTree[T], error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if len(t.nodes) > math.MaxInt32 {
+		return nil, ErrTreeTooLarge
+	}
+
+	f := &FrozenTree[T]{
+		Distance: t.Distance,
+		root:     -1,
+		items:    t.items,
+		skip:     t.skip,
+		affinity: t.affinity,
+	}
+	if t.scoreBounds != nil {
+		f.AffinityBounds = t.scoreBounds()
+	}
+	if t.root != nil {
+		f.nodes = make([]flatNode, 0, len(t.items))
+		f.root = f.flatten(t.root, t.nodes)
+	}
+	return f, nil
+}
+
+// flatten appends the subtree in pre-order and returns its position
+func (f *FrozenTree[T]) flatten(node *VPTreeNode, nodes []*VPTreeNode) int32 {
+	if node == nil {
+		return -1
+	}
+	pos := len(f.nodes)
+	n := flatNode{
+		threshold: node.threshold,
+		m:         node.m,
+		M:         node.M,
+		index:     uint32(node.index),
+	}
+	if node._dead {
+		n.flags |= flatNodeDead
+	}
+	if node.isLeaf {
+		n.flags |= flatNodeLeaf
+		n.left = int32(len(f.children))
+		n.right = int32(len(node.children))
+		for _, idx := range node.children {
+			child := uint32(idx)
+			if nodes[idx]._dead {
+				child |= flatChildDead
+			}
+			f.children = append(f.children, child)
+		}
+		f.nodes = append(f.nodes, n)
+		return int32(pos)
+	}
+	f.nodes = append(f.nodes, n)
+	left := f.flatten(node.left, nodes)
+	right := f.flatten(node.right, nodes)
+	f.nodes[pos].left = left
+	f.nodes[pos].right = right
+	return int32(pos)
+}
+
+// OpenFrozenTree memory maps a node file written by WriteNodesTo. The items
+// must be the same, in the same order, as those of the tree that was frozen.
+// Close must be called to release the mapping.
+func OpenFrozenTree[T any](path string, items []T, distance func(a, b T) float64) (*FrozenTree[T], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, unmap, err := mapFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FrozenTree[T]{Distance: distance, items: items, unmap: unmap}
+	if err := f.load(data); err != nil {
+		unmap()
+		return nil, err
+	}
+	return f, nil
+}
+
+// OpenFrozenVPTree memory maps a node file written from a frozen VPTree. The
+// items must be the same, in the same order, as the VPTree's Items.
+func OpenFrozenVPTree(path string, items []VPTreeItem, distancer VPTreeDistancer) (*FrozenTree[VPTreeItem], error) {
+	f, err := OpenFrozenTree(path, items, distancer.Distance)
+	if err != nil {
+		return nil, err
+	}
+	f.skip = func(item, target VPTreeItem) bool {
+		return item.ShouldSkip(target)
+	}
+	f.affinity = func(dist float64, item, target VPTreeItem) float64 {
+		return item.ApplyAffinity(dist, target)
+	}
+	return f, nil
+}
+
+// ReadFrozenTree reads a node file written by WriteNodesTo into memory
+func ReadFrozenTree[T any](r io.Reader, items []T, distance func(a, b T) float64) (*FrozenTree[T], error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f := &FrozenTree[T]{Distance: distance, items: items}
+	if err := f.load(data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// load validates the node file in data and points the tree at its nodes
+func (f *FrozenTree[T]) load(data []byte) error {
+	if len(data) < frozenHeaderSize || string(data[:4]) != frozenMagic {
+		return ErrInvalidFormat
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != frozenFormatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	count := binary.LittleEndian.Uint64(data[8:])
+	root := int32(binary.LittleEndian.Uint32(data[16:]))
+	childCount := uint64(binary.LittleEndian.Uint32(data[20:]))
+	body := data[frozenHeaderSize:]
+	if count > uint64(len(body)/flatNodeSize) ||
+		uint64(len(body)) != count*uint64(flatNodeSize)+childCount*4 {
+		return ErrInvalidFormat
+	}
+	nodeData := body[:count*uint64(flatNodeSize)]
+	childData := body[len(nodeData):]
+
+	var nodes []flatNode
+	var children []uint32
+	direct := nativeLittleEndian() && len(body) > 0 &&
+		uintptr(unsafe.Pointer(&body[0]))%unsafe.Alignof(flatNode{}) == 0
+	if count > 0 {
+		if direct {
+			nodes = unsafe.Slice((*flatNode)(unsafe.Pointer(&nodeData[0])), count)
+		} else {
+			nodes = make([]flatNode, count)
+			for i := range nodes {
+				nodes[i] = decodeFlatNode(nodeData[i*flatNodeSize:])
+			}
+		}
+	}
+	if childCount > 0 {
+		if direct {
+			children = unsafe.Slice((*uint32)(unsafe.Pointer(&childData[0])), childCount)
+		} else {
+			children = make([]uint32, childCount)
+			for i := range children {
+				children[i] = binary.LittleEndian.Uint32(childData[i*4:])
+			}
+		}
+	}
+
+	if (count == 0 && root != -1) || (count > 0 && (root < 0 || int64(root) >= int64(count))) {
+		return ErrInvalidFormat
+	}
+	// Nodes are stored in pre-order so children always follow their parent,
+	// which also rules out cycles in a corrupt file
+	for pos, n := range nodes {
+		if int(n.index) >= len(f.items) {
+			return ErrInvalidFormat
+		}
+		if n.flags&flatNodeLeaf != 0 {
+			if n.left < 0 || n.right < 0 || uint64(n.left)+uint64(n.right) > childCount {
+				return ErrInvalidFormat
+			}
+			continue
+		}
+		if (n.left != -1 && (int(n.left) <= pos || int64(n.left) >= int64(count))) ||
+			(n.right != -1 && (int(n.right) <= pos || int64(n.right) >= int64(count))) {
+			return ErrInvalidFormat
+		}
+	}
+	for _, child := range children {
+		if int(child&^flatChildDead) >= len(f.items) {
+			return ErrInvalidFormat
+		}
+	}
+
+	f.nodes = nodes
+	f.children = children
+	f.root = root
+	return nil
+}
+
+func nativeLittleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
+
+func encodeFlatNode(buf []byte, n flatNode) {
+	binary.LittleEndian.PutUint64(buf[0:], math.Float64bits(n.threshold))
+	binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(n.m))
+	binary.LittleEndian.PutUint64(buf[16:], math.Float64bits(n.M))
+	binary.LittleEndian.PutUint32(buf[24:], n.index)
+	binary.LittleEndian.PutUint32(buf[28:], uint32(n.left))
+	binary.LittleEndian.PutUint32(buf[32:], uint32(n.right))
+	binary.LittleEndian.PutUint32(buf[36:], n.flags)
+}
+
+func decodeFlatNode(buf []byte) flatNode {
+	return flatNode{
+		threshold: math.Float64frombits(binary.LittleEndian.Uint64(buf[0:])),
+		m:         math.Float64frombits(binary.LittleEndian.Uint64(buf[8:])),
+		M:         math.Float64frombits(binary.LittleEndian.Uint64(buf[16:])),
+		index:     binary.LittleEndian.Uint32(buf[24:]),
+		left:      int32(binary.LittleEndian.Uint32(buf[28:])),
+		right:     int32(binary.LittleEndian.Uint32(buf[32:])),
+		flags:     binary.LittleEndian.Uint32(buf[36:]),
+	}
+}
+
+// WriteNodesTo writes the node file for the tree to w. The items are not
+// included and have to be stored separately by the caller.
+func (f *FrozenTree[T]) WriteNodesTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	header := make([]byte, frozenHeaderSize)
+	copy(header, frozenMagic)
+	binary.LittleEndian.PutUint32(header[4:], frozenFormatVersion)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(f.nodes)))
+	binary.LittleEndian.PutUint32(header[16:], uint32(f.root))
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(f.children)))
+	if _, err := bw.Write(header); err != nil {
+		return cw.n, err
+	}
+
+	buf := make([]byte, flatNodeSize)
+	for _, n := range f.nodes {
+		encodeFlatNode(buf, n)
+		if _, err := bw.Write(buf); err != nil {
+			return cw.n, err
+		}
+	}
+	for _, child := range f.children {
+		binary.LittleEndian.PutUint32(buf, child)
+		if _, err := bw.Write(buf[:4]); err != nil {
+			return cw.n, err
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Close releases the memory mapping, if any. The tree must not be used after
+// it is closed.
+func (f *FrozenTree[T]) Close() error {
+	f.nodes = nil
+	f.children = nil
+	if f.unmap == nil {
+		return nil
+	}
+	unmap := f.unmap
+	f.unmap = nil
+	return unmap()
+}
+
+// ItemCount returns the number of items in the tree
+func (f *FrozenTree[T]) ItemCount() int {
+	return len(f.items)
+}
+
+// Items returns the items the tree was opened with
+func (f *FrozenTree[T]) Items() []T {
+	return f.items
+}
+
+// Search returns the nearest k items to the target. The items are sorted with
+// by distance ascending. The second parameter is the repective distances to the
+// target
+func (f *FrozenTree[T]) Search(target T, k int) ([]T, []float64) {
+	return f.SearchInRange(target, k, math.MaxFloat64)
+}
+
+// SearchInRange returns the nearest k items to the target sorted by distance
+// ascending with no result being more that maxDistance away from the target.
+func (f *FrozenTree[T]) SearchInRange(target T, k int, maxDist float64) ([]T, []float64) {
+	if k <= 0 {
+		return []T{}, []float64{}
+	}
+
+	tau := maxDist
+	pq := &PriorityQueue{}
+	heap.Init(pq)
+
+	f.search(f.root, target, k, pq, &tau, maxDist)
+
+	results := make([]T, pq.Len())
+	distances := make([]float64, pq.Len())
+	for i := pq.Len() - 1; i >= 0; i-- {
+		item := heap.Pop(pq).(*vpHeapItem)
+		results[i] = f.items[item.index]
+		distances[i] = item.Priority()
+	}
+	return results, distances
+}
+
+func (f *FrozenTree[T]) search(pos int32, target T, k int, pq *PriorityQueue, tau *float64, maxDist float64) {
+	if pos < 0 {
+		return
+	}
+	node := &f.nodes[pos]
+
+	if node.flags&flatNodeLeaf != 0 {
+		f.searchLeaf(node, target, k, pq, tau, maxDist)
+		return
+	}
+
+	if node.flags&flatNodeDead != 0 || (f.skip != nil && f.skip(f.items[node.index], target)) {
+		f.search(node.left, target, k, pq, tau, maxDist)
+		f.search(node.right, target, k, pq, tau, maxDist)
+		return
+	}
+
+	t := f.AffinityBounds.radius(*tau)
+	dist := f.offer(int(node.index), target, k, pq, tau, maxDist)
+
+	if node.left < 0 && node.right < 0 {
+		return
+	}
+
+	if dist < node.threshold {
+		if node.left >= 0 && node.m-t <= dist {
+			f.search(node.left, target, k, pq, tau, maxDist)
+		}
+		if node.right >= 0 && node.threshold-t < dist && dist < node.M+t {
+			f.search(node.right, target, k, pq, tau, maxDist)
+		}
+	} else {
+		if node.right >= 0 && node.m-t < dist {
+			f.search(node.right, target, k, pq, tau, maxDist)
+		}
+		if node.left >= 0 && node.m-t < dist && dist < node.threshold+t {
+			f.search(node.left, target, k, pq, tau, maxDist)
+		}
+	}
+}
+
+// searchLeaf scans the vantage point and the children of a leaf bucket
+func (f *FrozenTree[T]) searchLeaf(node *flatNode, target T, k int, pq *PriorityQueue, tau *float64, maxDist float64) {
+	if node.flags&flatNodeDead == 0 && (f.skip == nil || !f.skip(f.items[node.index], target)) {
+		t := f.AffinityBounds.radius(*tau)
+		dist := f.offer(int(node.index), target, k, pq, tau, maxDist)
+		if dist-node.M >= t || node.m-dist >= t {
+			return
+		}
+	}
+
+	for _, child := range f.children[node.left : node.left+node.right] {
+		if child&flatChildDead != 0 {
+			continue
+		}
+		idx := int(child)
+		if f.skip != nil && f.skip(f.items[idx], target) {
+			continue
+		}
+		f.offer(idx, target, k, pq, tau, maxDist)
+	}
+}
+
+// offer adds the item at idx to the results when it is close enough to the
+// target and returns its raw distance
+func (f *FrozenTree[T]) offer(idx int, target T, k int, pq *PriorityQueue, tau *float64, maxDist float64) float64 {
+	item := f.items[idx]
+	dist := f.Distance(item, target)
+	priority := dist
+	if f.affinity != nil && dist < maxDist {
+		priority = f.affinity(dist, item, target)
+	}
+
+	if priority < *tau {
+		if pq.Len() == k {
+			heap.Pop(pq)
+		}
+		heap.Push(pq, &vpHeapItem{index: idx, dist: priority})
+		if pq.Len() == k {
+			*tau = (*pq)[0].Priority()
+		}
+	}
+	return dist
+}
+
+// Freeze returns a read-only copy of the tree's current structure, see
+// Tree.Freeze
+func (v *VPTree) Freeze() (*FrozenTree[VPTreeItem], error) {
+	return v.core().Freeze()
+}
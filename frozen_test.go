@@ -0,0 +1,120 @@
+package search
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFrozenTreeMatchesTree(t *testing.T) {
+	for _, size := range []int{0, 6} {
+		testFrozenTreeMatchesTree(t, size)
+	}
+}
+
+func testFrozenTreeMatchesTree(t *testing.T, maxChildren int) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+	tree.MaxChildren = maxChildren
+
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 30; j++ {
+			points = append(points, &Point{
+				Lat:  float64(i),
+				Lon:  float64(j),
+				Date: i + j})
+		}
+	}
+	tree.SetItems(points)
+	for i := 0; i < 20; i++ {
+		tree.Insert(&Point{Lat: 5.5 + float64(i)/100, Lon: 5.5})
+	}
+	tree.Remove(&Point{Lat: 7, Lon: 7})
+	tree.Remove(&Point{Lat: 5.6, Lon: 5.5})
+
+	frozen, err := tree.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tree.nodes")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := frozen.WriteNodesTo(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped, err := OpenFrozenVPTree(path, tree.Items(), &distancer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	for _, ft := range []*FrozenTree[VPTreeItem]{frozen, mapped} {
+		if ft.ItemCount() != tree.ItemCount() {
+			t.Fatal("Expected", tree.ItemCount(), "items, got", ft.ItemCount())
+		}
+		for i := 0; i < 30; i++ {
+			for j := 0; j < 30; j++ {
+				p := &Point{Lat: float64(i) + 0.3, Lon: float64(j) + 0.3}
+				want, wantDist := tree.SearchInRange(p, 4, 200000)
+				got, gotDist := ft.SearchInRange(p, 4, 200000)
+				if len(want) != len(got) {
+					t.Fatal("Result count differs", len(want), len(got))
+				}
+				for r := range want {
+					if want[r] != got[r] || wantDist[r] != gotDist[r] {
+						t.Fatal("Frozen tree returned", got[r], "expected", want[r])
+					}
+				}
+			}
+		}
+	}
+
+	results, _ := mapped.Search(&Point{Lat: 7, Lon: 7}, 1)
+	if p := results[0].(*Point); p.Lat == 7 && p.Lon == 7 {
+		t.Fatal("Removed point returned from frozen tree")
+	}
+
+	// Like Tree, no results are asked for below 1
+	for _, k := range []int{0, -1} {
+		if results, distances := frozen.Search(&Point{Lat: 7, Lon: 7}, k); len(results) != 0 || len(distances) != 0 {
+			t.Fatal("Expected no results for k", k, "got", len(results))
+		}
+	}
+}
+
+func TestReadFrozenTree(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(10))
+
+	var buf bytes.Buffer
+	frozen, err := tree.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := frozen.WriteNodesTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadFrozenTree(bytes.NewReader(buf.Bytes()), tree.Items()[:5], cityDistance); err == nil {
+		t.Fatal("Expected error when items do not match the node file")
+	}
+
+	frozen, err = ReadFrozenTree(&buf, tree.Items(), cityDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, distances := frozen.Search(city{Lat: 3, Lon: 4}, 1)
+	if len(results) != 1 || results[0].Lat != 3 || results[0].Lon != 4 || distances[0] != 0 {
+		t.Fatal("Frozen tree returned", results, distances)
+	}
+}
@@ -0,0 +1,152 @@
+package search
+
+import (
+	"sort"
+	"sync"
+)
+
+// HashIndex finds near-duplicates of perceptual hashes, for example 64 bit
+// pHashes of images, by the number of bits that differ. Every hash is stored
+// under an ID. Hashes longer than 64 bits are given as words of 64 bits, a
+// shorter hash compares as if padded with zero words. The zero value is an
+// empty index.
+type HashIndex struct {
+	// MaxChildren is the largest number of hashes stored in a leaf bucket,
+	// see VPTree. It must be set before the index is first used.
+	MaxChildren int
+	tree        VPTree
+	once        sync.Once
+}
+
+// index returns the tree with its distancer set up
+func (h *HashIndex) index() *VPTree {
+	h.once.Do(func() {
+		h.tree.Distancer = &HammingDistancer{}
+		h.tree.MaxChildren = h.MaxChildren
+	})
+	return &h.tree
+}
+
+// SetHashes will (re)build the index for the 64 bit hashes, each stored under
+// the ID at the same position
+func (h *HashIndex) SetHashes(ids []string, hashes []uint64) error {
+	items := make([]VPTreeItem, len(hashes))
+	for i, hash := range hashes {
+		items[i] = NewBitset(hash)
+	}
+	return h.index().SetItemsWithIDs(ids, items)
+}
+
+// SetBitsets will (re)build the index for hashes of any length, each stored
+// under the ID at the same position
+func (h *HashIndex) SetBitsets(ids []string, hashes [][]uint64) error {
+	items := make([]VPTreeItem, len(hashes))
+	for i, bits := range hashes {
+		items[i] = NewBitset(bits...)
+	}
+	return h.index().SetItemsWithIDs(ids, items)
+}
+
+// Add stores a 64 bit hash under the ID
+func (h *HashIndex) Add(id string, hash uint64) error {
+	return h.index().InsertWithID(id, NewBitset(hash))
+}
+
+// AddBits stores a hash of any length under the ID
+func (h *HashIndex) AddBits(id string, bits []uint64) error {
+	return h.index().InsertWithID(id, NewBitset(bits...))
+}
+
+// Remove marks the hash stored under the ID for removal. It returns false if
+// no hash is stored under the ID.
+func (h *HashIndex) Remove(id string) bool {
+	return h.index().RemoveID(id)
+}
+
+// ItemCount returns the number of hashes in the index
+func (h *HashIndex) ItemCount() int {
+	return h.index().ItemCount()
+}
+
+// Search returns the IDs of up to k hashes at most maxBits bits different from
+// the 64 bit hash sorted by the number of differing bits ascending, along with
+// those numbers. When k is 0 or less every hash within maxBits is returned.
+func (h *HashIndex) Search(hash uint64, maxBits, k int) ([]string, []int) {
+	return h.SearchBits([]uint64{hash}, maxBits, k)
+}
+
+// SearchBits is Search for a hash of any length
+func (h *HashIndex) SearchBits(bits []uint64, maxBits, k int) ([]string, []int) {
+	t := h.index().core()
+	target := NewBitset(bits...)
+	maxDist := float64(maxBits) + 0.5
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if k < 0 {
+		k = 0
+	}
+	s := t.newSearcher(target, k, maxDist)
+	s.search(t.root)
+	indices, distances := s.indices()
+
+	ids := make([]string, len(indices))
+	counts := make([]int, len(indices))
+	for i, idx := range indices {
+		ids[i] = t.itemIDs[idx]
+		counts[i] = int(distances[i])
+	}
+	return ids, counts
+}
+
+// FindDuplicates returns groups of IDs whose hashes are near-identical. Two
+// hashes at most maxBits bits apart share a group, and so do hashes linked
+// through a chain of such pairs. Every group holds at least two IDs, the IDs
+// of a group and the groups are sorted.
+func (h *HashIndex) FindDuplicates(maxBits int) [][]string {
+	t := h.index().core()
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	parent := make([]int, len(t.items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	t.join(t, float64(maxBits)+0.5, func(x, y *VPTreeNode, d float64) {
+		if x.index < y.index {
+			if a, b := find(x.index), find(y.index); a != b {
+				parent[b] = a
+			}
+		}
+	})
+
+	// Removed hashes are never linked and end up alone
+	byRoot := make(map[int][]string)
+	for i := range parent {
+		root := find(i)
+		byRoot[root] = append(byRoot[root], t.itemIDs[i])
+	}
+
+	groups := make([][]string, 0, len(byRoot))
+	for _, ids := range byRoot {
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Strings(ids)
+		groups = append(groups, ids)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+	return groups
+}
@@ -0,0 +1,117 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// flipBits returns the hash with n distinct random bits flipped
+func flipBits(hash uint64, n int) uint64 {
+	for _, bit := range rand.Perm(64)[:n] {
+		hash ^= 1 << uint(bit)
+	}
+	return hash
+}
+
+func TestHashIndexFindDuplicates(t *testing.T) {
+	ids := make([]string, 0)
+	hashes := make([]uint64, 0)
+	want := make([][]string, 0)
+
+	// Groups of near-identical images, the originals are far apart
+	for g := 0; g < 10; g++ {
+		original := rand.Uint64()
+		group := make([]string, 0)
+		for i := 0; i < 1+g%3; i++ {
+			id := fmt.Sprintf("img-%d-%d", g, i)
+			group = append(group, id)
+			ids = append(ids, id)
+			if i == 0 {
+				hashes = append(hashes, original)
+			} else {
+				hashes = append(hashes, flipBits(original, 2))
+			}
+		}
+		if len(group) > 1 {
+			want = append(want, group)
+		}
+	}
+
+	var index HashIndex
+	index.MaxChildren = 4
+	if err := index.SetHashes(ids, hashes); err != nil {
+		t.Fatal(err)
+	}
+
+	// The copies are at most 4 bits from each other and random hashes are
+	// about 32 bits apart
+	got := index.FindDuplicates(4)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("FindDuplicates returned", got, "expected", want)
+	}
+
+	index.Remove("img-2-1")
+	index.Remove("img-1-1")
+	got = index.FindDuplicates(4)
+	if len(got) != len(want)-1 || !reflect.DeepEqual(got[0], []string{"img-2-0", "img-2-2"}) {
+		t.Fatal("FindDuplicates after removal returned", got)
+	}
+
+	if len(index.FindDuplicates(0)) != 0 {
+		t.Fatal("Expected no exact duplicates")
+	}
+}
+
+func TestHashIndexSearch(t *testing.T) {
+	var index HashIndex
+	original := rand.Uint64()
+	if err := index.Add("original", original); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Add("resized", flipBits(original, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Add("other", ^original); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Add("original", original); !errors.Is(err, ErrDuplicateID) {
+		t.Fatal("Expected ErrDuplicateID, got", err)
+	}
+
+	ids, bits := index.Search(original, 5, 0)
+	if !reflect.DeepEqual(ids, []string{"original", "resized"}) || !reflect.DeepEqual(bits, []int{0, 3}) {
+		t.Fatal("Search returned", ids, bits)
+	}
+	ids, _ = index.Search(original, 64, 1)
+	if !reflect.DeepEqual(ids, []string{"original"}) {
+		t.Fatal("Search returned", ids)
+	}
+	if index.ItemCount() != 3 {
+		t.Fatal("Expected 3 hashes, got", index.ItemCount())
+	}
+}
+
+func TestHashIndexBitsets(t *testing.T) {
+	var index HashIndex
+	a := []uint64{rand.Uint64(), rand.Uint64()}
+	b := []uint64{a[0], flipBits(a[1], 1)}
+	c := []uint64{^a[0], a[1]}
+	if err := index.SetBitsets([]string{"a", "b", "c"}, [][]uint64{a, b, c}); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.AddBits("d", []uint64{a[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := index.FindDuplicates(1)
+	if !reflect.DeepEqual(got, [][]string{{"a", "b"}}) {
+		t.Fatal("FindDuplicates returned", got)
+	}
+	ids, bits := index.SearchBits(a, 128, 0)
+	if len(ids) != 4 || ids[0] != "a" || bits[3] != 64 {
+		t.Fatal("SearchBits returned", ids, bits)
+	}
+}
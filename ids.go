@@ -0,0 +1,148 @@
+package search
+
+import (
+	"errors"
+)
+
+var (
+	// ErrDuplicateID is returned when adding an item with an ID already in use
+	ErrDuplicateID = errors.New("search: duplicate id")
+	// ErrUnknownID is returned when no live item has the ID
+	ErrUnknownID = errors.New("search: unknown id")
+	// ErrEmptyID is returned when an ID is the empty string
+	ErrEmptyID = errors.New("search: empty id")
+	// ErrIDCount is returned when the number of IDs and items differ
+	ErrIDCount = errors.New("search: ids and items differ in length")
+	// ErrItemInPlace is returned by Update when the new item is already
+	// stored in the tree
+	ErrItemInPlace = errors.New("search: item is already stored in the tree")
+)
+
+// SetItemsWithIDs will (re)build the index for the slice of items, each
+// addressed by the ID at the same position. IDs stay attached to their items
+// across rebuilds, unlike positions in Items.
+func (t *Tree[T]) SetItemsWithIDs(ids []string, items []T) error {
+	if len(ids) != len(items) {
+		return ErrIDCount
+	}
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return ErrEmptyID
+		}
+		if _, ok := seen[id]; ok {
+			return ErrDuplicateID
+		}
+		seen[id] = struct{}{}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.setItemsWithIDs(items, append([]string(nil), ids...))
+	return nil
+}
+
+// InsertWithID adds a new item to the index addressed by id
+func (t *Tree[T]) InsertWithID(id string, item T) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+
+	t.mutex.Lock()
+	if _, ok := t.byID[id]; ok {
+		t.mutex.Unlock()
+		return ErrDuplicateID
+	}
+	t.insert(item, id)
+	event := t.checkPolicy()
+	t.mutex.Unlock()
+
+	t.applyPolicy(event)
+	return nil
+}
+
+// Get returns the live item with the ID
+func (t *Tree[T]) Get(id string) (T, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	idx, ok := t.byID[id]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return t.items[idx], true
+}
+
+// Update replaces the item with the ID, for example to move it to new
+// coordinates. The old item is marked for removal and the new one inserted
+// under the same ID.
+//
+// The item must be a new value. The stored item must not be changed in place,
+// a removed item keeps routing inserts and bounding searches until the next
+// rebuild, so changing it breaks the tree. For a VPTree an item already
+// stored in the tree is rejected with ErrItemInPlace.
+func (t *Tree[T]) Update(id string, item T) error {
+	t.mutex.Lock()
+	idx, ok := t.byID[id]
+	if !ok {
+		t.mutex.Unlock()
+		return ErrUnknownID
+	}
+	if t.lookup != nil && t.owns(t.lookup(item)) {
+		t.mutex.Unlock()
+		return ErrItemInPlace
+	}
+	t.removeNode(t.nodes[idx])
+	t.insert(item, id)
+	event := t.checkPolicy()
+	t.mutex.Unlock()
+
+	t.applyPolicy(event)
+	return nil
+}
+
+// RemoveID marks the item with the ID for removal. It returns false if no live
+// item has the ID.
+func (t *Tree[T]) RemoveID(id string) bool {
+	t.mutex.Lock()
+	idx, ok := t.byID[id]
+	if ok {
+		t.removeNode(t.nodes[idx])
+	}
+	event := t.checkPolicy()
+	t.mutex.Unlock()
+
+	t.applyPolicy(event)
+	return ok
+}
+
+// SetItemsWithIDs will (re)build the index for the slice of items, each
+// addressed by the ID at the same position
+func (v *VPTree) SetItemsWithIDs(ids []string, items []VPTreeItem) error {
+	return v.core().SetItemsWithIDs(ids, items)
+}
+
+// InsertWithID adds a new item to the index addressed by id
+func (v *VPTree) InsertWithID(id string, item VPTreeItem) error {
+	return v.core().InsertWithID(id, item)
+}
+
+// Get returns the live item with the ID
+func (v *VPTree) Get(id string) (VPTreeItem, bool) {
+	return v.core().Get(id)
+}
+
+// Update replaces the item with the ID, the old item is marked for removal and
+// the new one inserted under the same ID. The item must be a new value, the
+// stored one must not be changed in place, see Tree.Update. An item already
+// stored in the tree returns ErrItemInPlace.
+func (v *VPTree) Update(id string, item VPTreeItem) error {
+	return v.core().Update(id, item)
+}
+
+// RemoveID marks the item with the ID for removal. It returns false if no live
+// item has the ID.
+func (v *VPTree) RemoveID(id string) bool {
+	return v.core().RemoveID(id)
+}
@@ -0,0 +1,258 @@
+package search
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestVPTreeStableIDs(t *testing.T) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+
+	ids := make([]string, 0)
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			ids = append(ids, fmt.Sprintf("%d-%d", i, j))
+			points = append(points, &Point{Lat: float64(i), Lon: float64(j)})
+		}
+	}
+	if err := tree.SetItemsWithIDs(ids, points); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tree.InsertWithID("vehicle", &Point{Lat: 2.5, Lon: 2.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.InsertWithID("vehicle", &Point{Lat: 3.5, Lon: 3.5}); !errors.Is(err, ErrDuplicateID) {
+		t.Fatal("Expected ErrDuplicateID, got", err)
+	}
+
+	// Move the vehicle
+	moved := &Point{Lat: 7.5, Lon: 7.5}
+	if err := tree.Update("vehicle", moved); err != nil {
+		t.Fatal(err)
+	}
+	item, ok := tree.Get("vehicle")
+	if !ok || item != VPTreeItem(moved) {
+		t.Fatal("Get returned", item, "expected", moved)
+	}
+	results, distances := tree.Search(&Point{Lat: 2.5, Lon: 2.5}, 1)
+	if distances[0] == 0 {
+		t.Fatal("Old vehicle position still returned", results[0])
+	}
+	results, distances = tree.Search(moved, 1)
+	if results[0] != VPTreeItem(moved) || distances[0] != 0 {
+		t.Fatal("New vehicle position not found")
+	}
+
+	if !tree.RemoveID("5-5") {
+		t.Fatal("RemoveID returned false for a live item")
+	}
+	if tree.RemoveID("5-5") {
+		t.Fatal("RemoveID returned true for a removed item")
+	}
+	if _, ok := tree.Get("5-5"); ok {
+		t.Fatal("Get returned a removed item")
+	}
+	if err := tree.Update("5-5", moved); !errors.Is(err, ErrUnknownID) {
+		t.Fatal("Expected ErrUnknownID, got", err)
+	}
+
+	// IDs survive rebuilds even though positions change
+	tree.Rebuild()
+	<-tree.RebuildAsync()
+	if n := tree.ItemCount(); n != 100 {
+		t.Fatal("Expected 100 items after rebuild, got", n)
+	}
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			id := fmt.Sprintf("%d-%d", i, j)
+			item, ok := tree.Get(id)
+			if id == "5-5" {
+				if ok {
+					t.Fatal("Removed item returned after rebuild")
+				}
+				continue
+			}
+			p := item.(*Point)
+			if !ok || p.Lat != float64(i) || p.Lon != float64(j) {
+				t.Fatal("Get", id, "returned", item)
+			}
+		}
+	}
+	if item, ok := tree.Get("vehicle"); !ok || item != VPTreeItem(moved) {
+		t.Fatal("Vehicle lost after rebuild")
+	}
+
+	// IDs can be reused once removed
+	if err := tree.InsertWithID("5-5", &Point{Lat: 5, Lon: 5}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVPTreeUpdateMovesVehicles(t *testing.T) {
+	var distancer PointDistancer
+	tree := VPTree{Distancer: &distancer, MaxChildren: 4}
+
+	ids := make([]string, 0)
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 20; i++ {
+		ids = append(ids, fmt.Sprintf("vehicle-%d", i))
+		points = append(points, &Point{Lat: rand.Float64() * 10, Lon: rand.Float64() * 10})
+	}
+	if err := tree.SetItemsWithIDs(ids, points); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every move stores a fresh value, the stored points are never changed
+	for i := 0; i < 500; i++ {
+		id := ids[rand.Intn(len(ids))]
+		old, _ := tree.Get(id)
+		p := old.(*Point)
+		moved := &Point{Lat: p.Lat + rand.Float64() - 0.5, Lon: p.Lon + rand.Float64() - 0.5}
+		if err := tree.Update(id, moved); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Passing back a stored point, as after changing it in place, is rejected
+	// without touching the tree
+	for _, id := range ids[:5] {
+		stored, _ := tree.Get(id)
+		if err := tree.Update(id, stored); !errors.Is(err, ErrItemInPlace) {
+			t.Fatal("Expected ErrItemInPlace, got", err)
+		}
+		if item, ok := tree.Get(id); !ok || item != stored || item.GetNode().IsDead() {
+			t.Fatal("Rejected update changed", id)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		target := &Point{Lat: rand.Float64() * 10, Lon: rand.Float64() * 10}
+		want := make([]float64, 0, len(ids))
+		for _, id := range ids {
+			item, _ := tree.Get(id)
+			want = append(want, distancer.Distance(item, target))
+		}
+		sort.Float64s(want)
+
+		got := make([]float64, 0, len(ids))
+		for item, dist := range tree.Nearest(target).All() {
+			if item.GetNode().IsDead() {
+				t.Fatal("Nearest returned an old vehicle position")
+			}
+			got = append(got, dist)
+		}
+		if len(got) != len(want) {
+			t.Fatal("Nearest returned", len(got), "vehicles, expected", len(want))
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatal("Nearest returned", got[j], "at", j, "expected", want[j])
+			}
+		}
+	}
+}
+
+func TestTreeIDsDuringRebuildAsync(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	cities := gridCities(10)
+	ids := make([]string, len(cities))
+	for i := range cities {
+		ids[i] = fmt.Sprint(i)
+	}
+	if err := tree.SetItemsWithIDs(ids, cities); err != nil {
+		t.Fatal(err)
+	}
+
+	built := make(chan struct{})
+	release := make(chan struct{})
+	testHookRebuildBuilt = func() {
+		close(built)
+		<-release
+	}
+	defer func() { testHookRebuildBuilt = nil }()
+
+	done := tree.RebuildAsync()
+	<-built
+	moved := city{Name: "moved", Lat: 4.5, Lon: 4.5}
+	if err := tree.Update("3", moved); err != nil {
+		t.Fatal(err)
+	}
+	tree.RemoveID("4")
+	close(release)
+	<-done
+
+	if c, ok := tree.Get("3"); !ok || c != moved {
+		t.Fatal("Update during rebuild lost, got", c)
+	}
+	if _, ok := tree.Get("4"); ok {
+		t.Fatal("Removal during rebuild lost")
+	}
+	if c, ok := tree.Get("5"); !ok || c != cities[5] {
+		t.Fatal("Untouched item lost, got", c)
+	}
+}
+
+func TestTreeSetItemsWithIDsErrors(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	if err := tree.SetItemsWithIDs([]string{"a"}, gridCities(2)); !errors.Is(err, ErrIDCount) {
+		t.Fatal("Expected ErrIDCount, got", err)
+	}
+	if err := tree.SetItemsWithIDs([]string{"a", "a"}, gridCities(2)[:2]); !errors.Is(err, ErrDuplicateID) {
+		t.Fatal("Expected ErrDuplicateID, got", err)
+	}
+	if err := tree.InsertWithID("", city{}); !errors.Is(err, ErrEmptyID) {
+		t.Fatal("Expected ErrEmptyID, got", err)
+	}
+}
+
+func TestVPTreeIDsWriteRead(t *testing.T) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+
+	ids := make([]string, 0)
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 5; i++ {
+		ids = append(ids, fmt.Sprint("p", i))
+		points = append(points, &Point{Lat: float64(i), Lon: float64(i)})
+	}
+	if err := tree.SetItemsWithIDs(ids, points); err != nil {
+		t.Fatal(err)
+	}
+	tree.RemoveID("p1")
+
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadVPTree(&buf, decodePoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Distancer = &distancer
+
+	if _, ok := loaded.Get("p1"); ok {
+		t.Fatal("Removed ID returned from loaded tree")
+	}
+	item, ok := loaded.Get("p3")
+	if p := item.(*Point); !ok || p.Lat != 3 {
+		t.Fatal("Loaded tree returned", item, "for p3")
+	}
+	if err := loaded.Update("p3", &Point{Lat: 9, Lon: 9}); err != nil {
+		t.Fatal(err)
+	}
+}
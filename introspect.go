@@ -0,0 +1,243 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrInvalidTree is returned by Validate when the tree structure is broken
+var ErrInvalidTree = errors.New("search: invalid tree")
+
+// TreeStats describes the shape of a tree. Insert places items below the node
+// they reach without rebalancing, comparing Height and AverageLeafDepth to
+// log2(Nodes) and Balance to 0.5 shows how far the tree has degenerated.
+type TreeStats struct {
+	// Nodes is the number of nodes, including those marked for removal
+	Nodes int
+	// Dead is the number of nodes marked for removal
+	Dead int
+	// Leaves is the number of nodes without subtrees or bucket children
+	Leaves int
+	// Height is the number of nodes on the longest path from the root. The
+	// children of a leaf bucket are one level below its vantage point.
+	Height int
+	// AverageLeafDepth is the mean depth of the leaves, the root is at depth 1
+	AverageLeafDepth float64
+	// Threshold is the distribution of the split distances of the vantage
+	// points with subtrees
+	Threshold Distribution
+	// Spread is the distribution of M-m, the width of the distance bounds,
+	// of the vantage points with subtrees or bucket children
+	Spread Distribution
+	// Balance is the distribution of the share of nodes in the left subtree
+	// of the vantage points with subtrees, 0.5 is perfectly balanced
+	Balance Distribution
+}
+
+// Distribution summarizes a set of values
+type Distribution struct {
+	Count                  int
+	Min, Median, Mean, Max float64
+}
+
+// newDistribution summarizes the values, sorting them in place
+func newDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return Distribution{
+		Count:  len(values),
+		Min:    values[0],
+		Median: values[len(values)/2],
+		Mean:   sum / float64(len(values)),
+		Max:    values[len(values)-1],
+	}
+}
+
+// treeWalk collects the statistics of the nodes
+type treeWalk struct {
+	stats                      TreeStats
+	depths                     int
+	threshold, spread, balance []float64
+}
+
+// visit adds the subtree of node at depth and returns its number of nodes
+func (w *treeWalk) visit(node *VPTreeNode, depth int) int {
+	if node == nil {
+		return 0
+	}
+	if len(node.children) > 0 {
+		w.spread = append(w.spread, node.M-node.m)
+		w.leaf(depth+1, len(node.children))
+		return len(node.children) + 1
+	}
+	if node.left == nil && node.right == nil {
+		w.leaf(depth, 1)
+		return 1
+	}
+
+	left := w.visit(node.left, depth+1)
+	right := w.visit(node.right, depth+1)
+	w.threshold = append(w.threshold, node.threshold)
+	w.spread = append(w.spread, node.M-node.m)
+	w.balance = append(w.balance, float64(left)/float64(left+right))
+	return left + right + 1
+}
+
+// leaf records n leaves at depth
+func (w *treeWalk) leaf(depth, n int) {
+	w.stats.Leaves += n
+	w.depths += depth * n
+	if depth > w.stats.Height {
+		w.stats.Height = depth
+	}
+}
+
+// Stats returns the shape of the tree, see TreeStats
+func (t *Tree[T]) Stats() TreeStats {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var w treeWalk
+	w.visit(t.root, 1)
+	w.stats.Nodes = len(t.nodes)
+	w.stats.Dead = len(t._deadIdx)
+	if w.stats.Leaves > 0 {
+		w.stats.AverageLeafDepth = float64(w.depths) / float64(w.stats.Leaves)
+	}
+	w.stats.Threshold = newDistribution(w.threshold)
+	w.stats.Spread = newDistribution(w.spread)
+	w.stats.Balance = newDistribution(w.balance)
+	return w.stats
+}
+
+// Validate checks the structure of the tree. Every node has to be reachable
+// from the root exactly once, and every item has to be within the bounds its
+// ancestors record: in [m, threshold] below the left and in [threshold, M]
+// below the right subtree of a vantage point, in [m, M] in a leaf bucket. It
+// returns an error wrapping ErrInvalidTree for the first violation found.
+//
+// Validate calculates the distance from every vantage point to each item
+// below it, it is meant for tests and debugging.
+func (t *Tree[T]) Validate() error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	seen := make([]bool, len(t.nodes))
+	members, err := t.validate(t.root, seen)
+	if err != nil {
+		return err
+	}
+	if len(members) != len(t.nodes) || len(t.items) != len(t.nodes) {
+		return fmt.Errorf("%w: %d of %d nodes reachable for %d items",
+			ErrInvalidTree, len(members), len(t.nodes), len(t.items))
+	}
+
+	dead := 0
+	for _, node := range t.nodes {
+		if node._dead {
+			dead++
+		}
+	}
+	if dead != len(t._deadIdx) {
+		return fmt.Errorf("%w: %d nodes marked for removal, %d recorded",
+			ErrInvalidTree, dead, len(t._deadIdx))
+	}
+	return nil
+}
+
+// validate checks the subtree of node and returns the indices of its items
+func (t *Tree[T]) validate(node *VPTreeNode, seen []bool) ([]int, error) {
+	if node == nil {
+		return nil, nil
+	}
+	if err := t.validateNode(node, seen); err != nil {
+		return nil, err
+	}
+	vp := t.items[node.index]
+
+	if node.isLeaf {
+		if node.left != nil || node.right != nil {
+			return nil, fmt.Errorf("%w: leaf %d has subtrees", ErrInvalidTree, node.index)
+		}
+		members := []int{node.index}
+		for _, idx := range node.children {
+			if idx < 0 || idx >= len(t.nodes) {
+				return nil, fmt.Errorf("%w: leaf %d has child %d out of range",
+					ErrInvalidTree, node.index, idx)
+			}
+			child := t.nodes[idx]
+			if err := t.validateNode(child, seen); err != nil {
+				return nil, err
+			}
+			if err := t.checkBounds(node, vp, idx, node.m, node.M); err != nil {
+				return nil, err
+			}
+			members = append(members, idx)
+		}
+		return members, nil
+	}
+
+	if len(node.children) > 0 {
+		return nil, fmt.Errorf("%w: vantage point %d has bucket children", ErrInvalidTree, node.index)
+	}
+	left, err := t.validate(node.left, seen)
+	if err != nil {
+		return nil, err
+	}
+	right, err := t.validate(node.right, seen)
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range left {
+		if err := t.checkBounds(node, vp, idx, node.m, node.threshold); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range right {
+		if err := t.checkBounds(node, vp, idx, node.threshold, node.M); err != nil {
+			return nil, err
+		}
+	}
+
+	members := append(left, right...)
+	return append(members, node.index), nil
+}
+
+// validateNode checks the node belongs to the tree and is reached only once
+func (t *Tree[T]) validateNode(node *VPTreeNode, seen []bool) error {
+	if !t.owns(node) {
+		return fmt.Errorf("%w: node %d does not belong to the tree", ErrInvalidTree, node.index)
+	}
+	if seen[node.index] {
+		return fmt.Errorf("%w: node %d reachable more than once", ErrInvalidTree, node.index)
+	}
+	seen[node.index] = true
+	return nil
+}
+
+// checkBounds checks the item at idx is within [lo, hi] from the vantage point
+func (t *Tree[T]) checkBounds(node *VPTreeNode, vp T, idx int, lo, hi float64) error {
+	dist := t.Distance(vp, t.items[idx])
+	if !(dist >= lo && dist <= hi) {
+		return fmt.Errorf("%w: item %d at %v from vantage point %d outside [%v, %v]",
+			ErrInvalidTree, idx, dist, node.index, lo, hi)
+	}
+	return nil
+}
+
+// Stats returns the shape of the tree, see Tree.Stats
+func (v *VPTree) Stats() TreeStats {
+	return v.core().Stats()
+}
+
+// Validate checks the structure of the tree, see Tree.Validate
+func (v *VPTree) Validate() error {
+	return v.core().Validate()
+}
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTreeValidateAfterChanges(t *testing.T) {
+	for _, size := range []int{0, 4} {
+		tree := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		tree.SetItems(gridCities(10))
+		if err := tree.Validate(); err != nil {
+			t.Fatal("Built tree with buckets of", size, err)
+		}
+
+		for i := 0; i < 300; i++ {
+			tree.Insert(city{Lat: rand.Float64() * 20, Lon: rand.Float64() * 20})
+			if i%3 == 0 {
+				tree.Remove(city{Lat: rand.Float64() * 20, Lon: rand.Float64() * 20})
+			}
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatal("Tree with buckets of", size, "after inserts", err)
+		}
+
+		<-tree.RebuildAsync()
+		if err := tree.Validate(); err != nil {
+			t.Fatal("Rebuilt tree with buckets of", size, err)
+		}
+	}
+
+	var empty Tree[city]
+	if err := empty.Validate(); err != nil {
+		t.Fatal("Empty tree", err)
+	}
+}
+
+func TestTreeValidateDetectsBrokenBounds(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(10))
+
+	tree.root.threshold /= 2
+	if err := tree.Validate(); !errors.Is(err, ErrInvalidTree) {
+		t.Fatal("Expected an invalid tree, got", err)
+	}
+	tree.root.threshold *= 2
+
+	tree.root.left, tree.root.right = tree.root.right, tree.root.left
+	if err := tree.Validate(); !errors.Is(err, ErrInvalidTree) {
+		t.Fatal("Expected an invalid tree, got", err)
+	}
+	tree.root.left, tree.root.right = tree.root.right, tree.root.left
+
+	tree.root.right = tree.root.left
+	if err := tree.Validate(); !errors.Is(err, ErrInvalidTree) {
+		t.Fatal("Expected an invalid tree, got", err)
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	cities := gridCities(16)
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(cities)
+
+	stats := tree.Stats()
+	if stats.Nodes != len(cities) || stats.Dead != 0 {
+		t.Fatal("Counted", stats.Nodes, "nodes", stats.Dead, "dead")
+	}
+	ideal := math.Log2(float64(len(cities)))
+	if float64(stats.Height) > ideal+2 || stats.AverageLeafDepth > ideal+1 {
+		t.Fatal("Built tree of height", stats.Height, "average leaf depth", stats.AverageLeafDepth)
+	}
+	if stats.Balance.Mean < 0.4 || stats.Balance.Mean > 0.5 {
+		t.Fatal("Built tree balanced", stats.Balance)
+	}
+	if stats.Threshold.Count != stats.Nodes-stats.Leaves || stats.Spread.Min < 0 {
+		t.Fatal("Distributions", stats.Threshold, stats.Spread)
+	}
+
+	tree.Remove(cities[0])
+	tree.Remove(cities[1])
+	// Items inserted further and further out all descend to the right
+	for i := 1; i <= 50; i++ {
+		tree.Insert(city{Lat: 20 + float64(i), Lon: 20 + float64(i)})
+	}
+	degenerate := tree.Stats()
+	if degenerate.Nodes != len(cities)+50 || degenerate.Dead != 2 {
+		t.Fatal("Counted", degenerate.Nodes, "nodes", degenerate.Dead, "dead")
+	}
+	if degenerate.Height < stats.Height+40 || degenerate.Balance.Min > 0.1 {
+		t.Fatal("Degenerate tree of height", degenerate.Height, "balanced", degenerate.Balance)
+	}
+
+	var empty Tree[city]
+	if stats := empty.Stats(); stats.Nodes != 0 || stats.Height != 0 || stats.Leaves != 0 {
+		t.Fatal("Empty tree", stats)
+	}
+}
+
+func TestVPTreeStatsBuckets(t *testing.T) {
+	tree := searchContextTree(&PointDistancer{})
+	tree.MaxChildren = 8
+	tree.SetItems(tree.Items())
+
+	stats := tree.Stats()
+	// Every vantage point with bucket children or subtrees has a spread
+	if stats.Leaves+stats.Spread.Count != stats.Nodes || stats.Threshold.Count >= stats.Spread.Count {
+		t.Fatal("Counted", stats.Leaves, "leaves", stats.Spread.Count, "vantage points of", stats.Nodes)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package search
+
+// ItemBase implements the bookkeeping of VPTreeItem. Embedding it in a struct
+// leaves only the distance to provide, its items are never skipped and have no
+// affinity.
+type ItemBase struct {
+	node *VPTreeNode
+}
+
+// GetNode returns the node the item is stored in
+func (i *ItemBase) GetNode() *VPTreeNode {
+	return i.node
+}
+
+// SetNode records the node the item is stored in
+func (i *ItemBase) SetNode(node *VPTreeNode) {
+	i.node = node
+}
+
+// ShouldSkip never skips the item
+func (i *ItemBase) ShouldSkip(target VPTreeItem) bool {
+	return false
+}
+
+// ApplyAffinity returns the distance unchanged
+func (i *ItemBase) ApplyAffinity(dist float64, target VPTreeItem) float64 {
+	return dist
+}
+
+// Vector is an item in a real vector space, see EuclideanDistancer,
+// ManhattanDistancer, ChebyshevDistancer and AngularDistancer
+type Vector struct {
+	ItemBase
+	Values []float64
+}
+
+// NewVector returns a vector item with the values
+func NewVector(values ...float64) *Vector {
+	return &Vector{Values: values}
+}
+
+// LatLon is an item at a coordinate in degrees, see HaversineDistancer and
+// VincentyDistancer
+type LatLon struct {
+	ItemBase
+	Lat, Lon float64
+}
+
+// NewLatLon returns a coordinate item
+func NewLatLon(lat, lon float64) *LatLon {
+	return &LatLon{Lat: lat, Lon: lon}
+}
+
+// Hash64 is an item identified by a 64 bit hash, for example a perceptual
+// hash, see HammingDistancer
+type Hash64 struct {
+	ItemBase
+	Hash uint64
+}
+
+// NewHash64 returns a hash item
+func NewHash64(hash uint64) *Hash64 {
+	return &Hash64{Hash: hash}
+}
+
+// Bitset is an item of arbitrary length bits stored 64 to a word, see
+// HammingDistancer
+type Bitset struct {
+	ItemBase
+	Bits []uint64
+}
+
+// NewBitset returns a bitset item with the words
+func NewBitset(bits ...uint64) *Bitset {
+	return &Bitset{Bits: bits}
+}
+
+// Text is a string item, see LevenshteinDistancer and
+// DamerauLevenshteinDistancer
+type Text struct {
+	ItemBase
+	Value string
+}
+
+// NewText returns a string item
+func NewText(value string) *Text {
+	return &Text{Value: value}
+}
+
+// Set is an item holding a set of members, see JaccardDistancer
+type Set[K comparable] struct {
+	ItemBase
+	Members map[K]struct{}
+}
+
+// NewSet returns a set item with the members
+func NewSet[K comparable](members ...K) *Set[K] {
+	s := &Set[K]{Members: make(map[K]struct{}, len(members))}
+	for _, m := range members {
+		s.Members[m] = struct{}{}
+	}
+	return s
+}
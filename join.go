@@ -0,0 +1,123 @@
+package search
+
+import (
+	"math"
+	"unsafe"
+)
+
+// JoinTrees calls fn for every pair of live items from a and b closer than
+// maxDist to each other, the distance between them is given as d. Both trees
+// are traversed together and pairs of subtrees too far apart are pruned as a
+// whole. The distance is calculated with a's Distance function. Joining a tree
+// with itself reports every pair in both orders and every item with itself.
+//
+// Both trees are read locked while fn runs, it must not modify them.
+func JoinTrees[T any](a, b *Tree[T], maxDist float64, fn func(x, y T, d float64)) {
+	// Lock in a fixed order so concurrent joins of the same trees in opposite
+	// orders can not deadlock with a waiting writer
+	first, second := a, b
+	if uintptr(unsafe.Pointer(b)) < uintptr(unsafe.Pointer(a)) {
+		first, second = b, a
+	}
+	first.mutex.RLock()
+	defer first.mutex.RUnlock()
+	if second != first {
+		second.mutex.RLock()
+		defer second.mutex.RUnlock()
+	}
+
+	a.join(b, maxDist, func(x, y *VPTreeNode, d float64) {
+		fn(a.items[x.index], b.items[y.index], d)
+	})
+}
+
+// join calls fn with the nodes of every pair of live items closer than
+// maxDist. It must be called with both trees read locked.
+func (t *Tree[T]) join(other *Tree[T], maxDist float64, fn func(x, y *VPTreeNode, d float64)) {
+	if t.root == nil || other.root == nil {
+		return
+	}
+	j := joiner[T]{a: t, b: other, maxDist: maxDist, fn: fn}
+	j.join(nodeRegion{node: t.root}, nodeRegion{node: other.root}, -1)
+}
+
+// Join calls fn for every pair of live items from a and b closer than maxDist
+// to each other, see JoinTrees. The distance is calculated with a's
+// Distancer.
+func Join(a, b *VPTree, maxDist float64, fn func(ia, ib VPTreeItem, d float64)) {
+	JoinTrees(a.core(), b.core(), maxDist, fn)
+}
+
+type joiner[T any] struct {
+	a, b    *Tree[T]
+	maxDist float64
+	fn      func(x, y *VPTreeNode, d float64)
+}
+
+// nodeRegion is either the subtree below node or when single only the
+// node's own item, for example a child of a leaf bucket
+type nodeRegion struct {
+	node   *VPTreeNode
+	single bool
+}
+
+// radius returns the largest distance from the vantage point to any item in
+// the region
+func (r nodeRegion) radius() float64 {
+	if r.single {
+		return 0
+	}
+	return math.Max(r.node.M, r.node.threshold)
+}
+
+// split calls fn for each region the items below the vantage point are
+// divided into
+func (r nodeRegion) split(nodes []*VPTreeNode, fn func(nodeRegion)) {
+	node := r.node
+	if node.isLeaf {
+		for _, idx := range node.children {
+			fn(nodeRegion{node: nodes[idx], single: true})
+		}
+		return
+	}
+	if node.left != nil {
+		fn(nodeRegion{node: node.left})
+	}
+	if node.right != nil {
+		fn(nodeRegion{node: node.right})
+	}
+}
+
+// join reports the close pairs between the items of two regions. dist is the
+// distance between their vantage points or negative when unknown. Every item
+// lies within its region's radius of the vantage point, so by the triangle
+// inequality no pair is closer than dist minus both radii.
+func (j *joiner[T]) join(ra, rb nodeRegion, dist float64) {
+	a, b := ra.node, rb.node
+	if dist < 0 {
+		dist = j.a.Distance(j.a.items[a.index], j.b.items[b.index])
+	}
+	if dist-ra.radius()-rb.radius() >= j.maxDist {
+		return
+	}
+
+	if ra.single && rb.single {
+		if dist < j.maxDist && !a._dead && !b._dead {
+			j.fn(a, b, dist)
+		}
+		return
+	}
+
+	// Split the larger region into its vantage point and the regions below
+	if rb.single || (!ra.single && ra.radius() >= rb.radius()) {
+		j.join(nodeRegion{node: a, single: true}, rb, dist)
+		ra.split(j.a.nodes, func(r nodeRegion) {
+			j.join(r, rb, -1)
+		})
+		return
+	}
+	j.join(ra, nodeRegion{node: b, single: true}, dist)
+	rb.split(j.b.nodes, func(r nodeRegion) {
+		j.join(ra, r, -1)
+	})
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"math/rand"
+	"testing"
+)
+
+type cityPair struct {
+	a, b city
+}
+
+func TestJoinTreesMatchesBruteForce(t *testing.T) {
+	for _, size := range []int{0, 6} {
+		pings := make([]city, 300)
+		for i := range pings {
+			pings[i] = city{Name: "ping", Lat: rand.Float64() * 5, Lon: rand.Float64() * 5}
+		}
+		pois := make([]city, 200)
+		for i := range pois {
+			pois[i] = city{Name: "poi", Lat: rand.Float64() * 5, Lon: rand.Float64() * 5}
+		}
+
+		a := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		a.SetItems(pings)
+		b := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		b.SetItems(pois)
+		for i := 0; i < 20; i++ {
+			b.Insert(city{Name: "poi", Lat: rand.Float64() * 5, Lon: rand.Float64() * 5})
+		}
+		a.Remove(pings[3])
+		b.Remove(pois[7])
+
+		const maxDist = 30000
+		want := make(map[cityPair]float64)
+		for i, x := range a.Items() {
+			for j, y := range b.Items() {
+				if a.nodes[i]._dead || b.nodes[j]._dead {
+					continue
+				}
+				if d := cityDistance(x, y); d < maxDist {
+					want[cityPair{x, y}] = d
+				}
+			}
+		}
+
+		got := make(map[cityPair]float64)
+		JoinTrees(&a, &b, maxDist, func(x, y city, d float64) {
+			if _, ok := got[cityPair{x, y}]; ok {
+				t.Fatal("Pair reported twice", x, y)
+			}
+			got[cityPair{x, y}] = d
+		})
+
+		if len(got) != len(want) {
+			t.Fatal("Expected", len(want), "pairs, got", len(got))
+		}
+		for pair, d := range want {
+			if got[pair] != d {
+				t.Fatal("Pair", pair, "at", got[pair], "expected", d)
+			}
+		}
+	}
+}
+
+func TestJoinSelf(t *testing.T) {
+	distancer := &countingDistancer{}
+	tree := searchContextTree(distancer)
+
+	distancer.calls = 0
+	pairs := 0
+	Join(tree, tree, 1, func(ia, ib VPTreeItem, d float64) {
+		if ia != ib || d != 0 {
+			t.Fatal("Expected only self pairs, got", ia, ib, d)
+		}
+		pairs++
+	})
+	if pairs != tree.ItemCount() {
+		t.Fatal("Expected", tree.ItemCount(), "self pairs, got", pairs)
+	}
+	n := tree.ItemCount()
+	if distancer.calls >= n*n/4 {
+		t.Fatal("Join made", distancer.calls, "distance calls for", n, "items")
+	}
+}
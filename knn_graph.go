@@ -0,0 +1,57 @@
+package search
+
+import (
+	"container/heap"
+)
+
+// KNNGraph returns the k nearest neighbors of every item. The neighbors of
+// the item at index i of Items are at index i of the returned slices, given as
+// indices into Items sorted by distance ascending together with their
+// distances. An item is not its own neighbor and items marked for removal
+// neither have nor are neighbors. Affinity is not applied. The searches run in
+// parallel on runtime.NumCPU() goroutines.
+func (t *Tree[T]) KNNGraph(k int) ([][]int, [][]float64) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	neighbors := make([][]int, len(t.items))
+	distances := make([][]float64, len(t.items))
+	if k <= 0 {
+		return neighbors, distances
+	}
+
+	t.searchParallel(len(t.items), k, 0, func(s *searcher[T], i int) {
+		node := t.nodes[i]
+		if node._dead {
+			return
+		}
+		s.target = t.items[i]
+		s.self = node
+		s.search(t.root)
+		neighbors[i], distances[i] = s.indices()
+	})
+
+	return neighbors, distances
+}
+
+// indices drains the queue into item indices and distances sorted ascending
+func (s *searcher[T]) indices() ([]int, []float64) {
+	pq := &s.pq
+	indices := make([]int, pq.Len())
+	distances := make([]float64, pq.Len())
+
+	for i := pq.Len() - 1; i >= 0; i-- {
+		item := heap.Pop(pq).(*vpHeapItem)
+		indices[i] = item.index
+		distances[i] = item.Priority()
+		s.spare = append(s.spare, item)
+	}
+
+	return indices, distances
+}
+
+// KNNGraph returns the k nearest neighbors of every item as indices into
+// Items, see Tree.KNNGraph
+func (v *VPTree) KNNGraph(k int) ([][]int, [][]float64) {
+	return v.core().KNNGraph(k)
+}
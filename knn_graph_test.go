@@ -0,0 +1,77 @@
+package search
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTreeKNNGraphMatchesBruteForce(t *testing.T) {
+	for _, size := range []int{0, 6} {
+		tree := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		cities := make([]city, 300)
+		for i := range cities {
+			cities[i] = city{Lat: rand.Float64() * 10, Lon: rand.Float64() * 10}
+		}
+		tree.SetItems(cities)
+		tree.Remove(cities[5])
+		tree.Remove(cities[17])
+
+		const k = 4
+		neighbors, distances := tree.KNNGraph(k)
+		if len(neighbors) != len(cities) || len(distances) != len(cities) {
+			t.Fatal("Expected", len(cities), "rows, got", len(neighbors))
+		}
+
+		for i, c := range cities {
+			if i == 5 || i == 17 {
+				if len(neighbors[i]) != 0 {
+					t.Fatal("Removed item", i, "has neighbors", neighbors[i])
+				}
+				continue
+			}
+
+			want := make([]float64, 0)
+			for j, other := range cities {
+				if j != i && j != 5 && j != 17 {
+					want = append(want, cityDistance(c, other))
+				}
+			}
+			sort.Float64s(want)
+
+			if len(neighbors[i]) != k {
+				t.Fatal("Item", i, "has", len(neighbors[i]), "neighbors")
+			}
+			for j, n := range neighbors[i] {
+				if n == i || n == 5 || n == 17 {
+					t.Fatal("Item", i, "has invalid neighbor", n)
+				}
+				if distances[i][j] != want[j] || cityDistance(c, cities[n]) != want[j] {
+					t.Fatal("Item", i, "neighbor", j, "at", distances[i][j], "expected", want[j])
+				}
+			}
+		}
+	}
+}
+
+func TestVPTreeKNNGraphDuplicates(t *testing.T) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+
+	// Two items at the same location are each other's nearest neighbor
+	points := []VPTreeItem{
+		&Point{Lat: 1, Lon: 1},
+		&Point{Lat: 1, Lon: 1},
+		&Point{Lat: 5, Lon: 5},
+	}
+	tree.SetItems(points)
+
+	neighbors, distances := tree.KNNGraph(1)
+	if neighbors[0][0] != 1 || neighbors[1][0] != 0 || distances[0][0] != 0 {
+		t.Fatal("Duplicates not neighbors", neighbors, distances)
+	}
+	if neighbors[2][0] != 0 && neighbors[2][0] != 1 {
+		t.Fatal("Unexpected neighbor", neighbors[2])
+	}
+}
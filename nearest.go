@@ -0,0 +1,237 @@
+package search
+
+import (
+	"container/heap"
+	"errors"
+	"iter"
+	"math"
+)
+
+// ErrIndexReplaced is returned by NearestIterator.Err when the iteration
+// stopped early because the whole index was replaced
+var ErrIndexReplaced = errors.New("search: index replaced during iteration")
+
+// NearestIterator walks the live items of a tree in order of increasing
+// distance to a target, see Tree.Nearest
+type NearestIterator[T any] struct {
+	tree   *Tree[T]
+	target T
+	err    error
+}
+
+// Nearest returns an iterator over the live items in order of increasing
+// distance to the target. The tree is traversed best first and only as far as
+// the caller consumes the sequence from All, so stopping early avoids the work
+// of visiting the rest of the tree. Affinity is not applied, the distances are
+// the raw distances to the target.
+//
+// The read lock is only held while looking for the next item, the tree may be
+// modified from the loop body. Items inserted during the iteration may or may
+// not be returned, items removed are not returned once removed. If the whole
+// index is replaced by SetItems or a rebuild, including one started by the
+// RebuildPolicy, the sequence ends early and Err returns ErrIndexReplaced.
+func (t *Tree[T]) Nearest(target T) *NearestIterator[T] {
+	return &NearestIterator[T]{tree: t, target: target}
+}
+
+// All returns the items and their distances to the target. Every call starts
+// a new traversal and resets Err.
+func (it *NearestIterator[T]) All() iter.Seq2[T, float64] {
+	return func(yield func(T, float64) bool) {
+		t := it.tree
+		it.err = nil
+
+		t.mutex.RLock()
+		n := nearestIter[T]{tree: t, target: it.target, generation: t.generation}
+		n.restart()
+		t.mutex.RUnlock()
+
+		for {
+			t.mutex.RLock()
+			item, dist, ok := n.next()
+			t.mutex.RUnlock()
+
+			if !ok {
+				if n.replaced {
+					it.err = ErrIndexReplaced
+				}
+				return
+			}
+			if !yield(item, dist) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns ErrIndexReplaced if the last sequence from All ended before
+// every item was returned because the index was replaced, otherwise nil
+func (it *NearestIterator[T]) Err() error {
+	return it.err
+}
+
+// nearestIter holds the state of a best first traversal. The queue holds both
+// subtrees keyed by a lower bound of their distance to the target and items
+// keyed by their exact distance.
+type nearestIter[T any] struct {
+	tree       *Tree[T]
+	target     T
+	generation uint64
+	splits     uint64
+	queue      nearestQueue
+	// replaced is set when the traversal stopped on a generation change
+	replaced bool
+
+	// last is the distance of the last item returned and ties the indices
+	// returned at that distance, used to resume after a restart
+	last float64
+	ties []int
+}
+
+type nearestEntry struct {
+	node *VPTreeNode
+	dist float64
+	// item is set when the entry is the node's own item and bucket when it
+	// is the children of a leaf, otherwise it is the subtree below the node
+	item, bucket bool
+}
+
+// push queues the subtree rooted at node with the lower bound dist
+func (n *nearestIter[T]) push(node *VPTreeNode, dist float64) {
+	if node != nil {
+		heap.Push(&n.queue, nearestEntry{node: node, dist: dist})
+	}
+}
+
+// restart queues the whole tree again. A bucket split moves items whose
+// subtree may already be queued, after one the traversal starts over and skips
+// the items it has already returned.
+func (n *nearestIter[T]) restart() {
+	n.splits = n.tree.splits
+	n.queue = n.queue[:0]
+	n.push(n.tree.root, 0)
+}
+
+// returned reports if the item at index and dist has already been returned
+func (n *nearestIter[T]) returned(index int, dist float64) bool {
+	if dist != n.last {
+		return dist < n.last
+	}
+	for _, idx := range n.ties {
+		if idx == index {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the closest item not yet returned. It must be called with the
+// read lock held.
+func (n *nearestIter[T]) next() (T, float64, bool) {
+	t := n.tree
+	if t.splits != n.splits {
+		n.restart()
+	}
+	for n.queue.Len() > 0 {
+		if t.generation != n.generation {
+			n.replaced = true
+			break
+		}
+		entry := heap.Pop(&n.queue).(nearestEntry)
+		node := entry.node
+
+		if entry.item {
+			if node._dead || n.returned(node.index, entry.dist) {
+				continue
+			}
+			if entry.dist != n.last {
+				n.last, n.ties = entry.dist, n.ties[:0]
+			}
+			n.ties = append(n.ties, node.index)
+			return t.items[node.index], entry.dist, true
+		}
+
+		if entry.bucket {
+			for _, idx := range node.children {
+				child := t.nodes[idx]
+				if n.skipped(child) {
+					continue
+				}
+				heap.Push(&n.queue, nearestEntry{
+					node: child,
+					dist: t.Distance(t.items[idx], n.target),
+					item: true})
+			}
+			continue
+		}
+
+		dist := t.Distance(t.items[node.index], n.target)
+		if !n.skipped(node) {
+			heap.Push(&n.queue, nearestEntry{node: node, dist: dist, item: true})
+		}
+
+		// Children lie within [m, threshold] of the vantage point on the left
+		// and within [threshold, M] on the right, leaf children within [m, M]
+		if node.isLeaf {
+			if len(node.children) > 0 {
+				heap.Push(&n.queue, nearestEntry{
+					node:   node,
+					dist:   subtreeBound(dist, node.m, node.M),
+					bucket: true})
+			}
+			continue
+		}
+		n.push(node.left, subtreeBound(dist, node.m, node.threshold))
+		n.push(node.right, subtreeBound(dist, node.threshold, node.M))
+	}
+
+	var zero T
+	return zero, 0, false
+}
+
+// skipped returns if the item should not be returned
+func (n *nearestIter[T]) skipped(node *VPTreeNode) bool {
+	t := n.tree
+	return node._dead || (t.skip != nil && t.skip(t.items[node.index], n.target))
+}
+
+// subtreeBound returns the smallest possible distance to the target of an item
+// that lies between lo and hi from a vantage point dist away from the target
+func subtreeBound(dist, lo, hi float64) float64 {
+	return math.Max(0, math.Max(lo-dist, dist-hi))
+}
+
+// nearestQueue is a min-heap of nearestEntry, items sort before subtrees at
+// the same distance so they are returned without expanding the subtree
+type nearestQueue []nearestEntry
+
+func (q nearestQueue) Len() int { return len(q) }
+
+func (q nearestQueue) Less(i, j int) bool {
+	if q[i].dist == q[j].dist {
+		return q[i].item && !q[j].item
+	}
+	return q[i].dist < q[j].dist
+}
+
+func (q nearestQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *nearestQueue) Push(x interface{}) {
+	*q = append(*q, x.(nearestEntry))
+}
+
+func (q *nearestQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	*q = old[0 : n-1]
+	return entry
+}
+
+// Nearest returns an iterator over the live items in order of increasing
+// distance to the target, see Tree.Nearest
+func (v *VPTree) Nearest(target VPTreeItem) *NearestIterator[VPTreeItem] {
+	return v.core().Nearest(target)
+}
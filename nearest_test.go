@@ -0,0 +1,140 @@
+package search
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTreeNearestMatchesBruteForce(t *testing.T) {
+	for _, size := range []int{0, 6} {
+		tree := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		cities := gridCities(15)
+		tree.SetItems(cities)
+		for i := 0; i < 20; i++ {
+			tree.Insert(city{Lat: rand.Float64() * 14, Lon: rand.Float64() * 14})
+		}
+		tree.Remove(cities[7])
+		tree.Remove(cities[100])
+
+		target := city{Lat: 6.3, Lon: 8.1}
+		want := make([]float64, 0)
+		for i, c := range tree.Items() {
+			if !tree.nodes[i]._dead {
+				want = append(want, cityDistance(c, target))
+			}
+		}
+		sort.Float64s(want)
+
+		got := make([]float64, 0)
+		for c, dist := range tree.Nearest(target).All() {
+			if cityDistance(c, target) != dist {
+				t.Fatal("Returned distance", dist, "for", c)
+			}
+			got = append(got, dist)
+		}
+		if len(got) != len(want) {
+			t.Fatal("Expected", len(want), "items, got", len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatal("Item", i, "at distance", got[i], "expected", want[i])
+			}
+		}
+	}
+}
+
+func TestVPTreeNearestIsLazy(t *testing.T) {
+	distancer := &countingDistancer{}
+	tree := searchContextTree(distancer)
+	target := &Point{Lat: 12.3, Lon: 4.4}
+	want, wantDist := tree.Search(target, 5)
+
+	distancer.calls = 0
+	i := 0
+	for item, dist := range tree.Nearest(target).All() {
+		if item != want[i] || dist != wantDist[i] {
+			t.Fatal("Returned", item, "expected", want[i])
+		}
+		i++
+		if i == len(want) {
+			break
+		}
+	}
+	if i != len(want) {
+		t.Fatal("Expected", len(want), "items, got", i)
+	}
+	if distancer.calls >= tree.ItemCount()/2 {
+		t.Fatal("Nearest made", distancer.calls, "distance calls for 5 of", tree.ItemCount(), "items")
+	}
+}
+
+func TestTreeNearestModifiedDuringIteration(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance, MaxChildren: 4}
+	cities := gridCities(10)
+	tree.SetItems(cities)
+	removed := cities[99]
+
+	target := city{Lat: 0.2, Lon: 0.1}
+	seen := make(map[city]int)
+	last := 0.0
+	it := tree.Nearest(target)
+	for c, dist := range it.All() {
+		if dist < last {
+			t.Fatal("Distances not ascending", last, dist)
+		}
+		last = dist
+		seen[c]++
+
+		// Inserts split buckets which restarts the traversal
+		tree.Insert(city{Name: "new", Lat: 9 + rand.Float64(), Lon: 9 + rand.Float64()})
+		if len(seen) == 10 {
+			tree.Remove(removed)
+		}
+	}
+
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	for _, c := range cities {
+		n := seen[c]
+		if c == removed {
+			if n != 0 {
+				t.Fatal("Removed item returned", c)
+			}
+			continue
+		}
+		if n != 1 {
+			t.Fatal("Item returned", n, "times", c)
+		}
+	}
+}
+
+func TestTreeNearestIndexReplaced(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance, MaxChildren: 4}
+	cities := gridCities(10)
+	tree.SetItems(cities)
+
+	target := city{Lat: 4.2, Lon: 5.1}
+	it := tree.Nearest(target)
+	returned := 0
+	for range it.All() {
+		returned++
+		if returned == 5 {
+			tree.Rebuild()
+		}
+	}
+	if returned != 5 || !errors.Is(it.Err(), ErrIndexReplaced) {
+		t.Fatal("Returned", returned, "items with error", it.Err())
+	}
+
+	// A new traversal runs over the rebuilt index
+	returned = 0
+	for range it.All() {
+		returned++
+	}
+	if returned != len(cities) || it.Err() != nil {
+		t.Fatal("Returned", returned, "items with error", it.Err())
+	}
+}
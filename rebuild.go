@@ -0,0 +1,245 @@
+package search
+
+import (
+	"math"
+)
+
+// testHookRebuildBuilt is called by RebuildAsync after the new index is built
+// and before it is swapped in
+var testHookRebuildBuilt func()
+
+// RebuildAsync rebuilds the index over the live items in the background like
+// Rebuild, without blocking searches or changes while the new index is built.
+// The build works on a copy of the live items so the current index keeps
+// serving. Once built, the new index replaces the current one and any inserts
+// and removals made in the meantime are replayed onto it.
+//
+// The returned channel is closed when the rebuild finishes. A rebuild already
+// in progress is shared. If the index is replaced in the meantime, by SetItems
+// or Rebuild, the background result is discarded.
+func (t *Tree[T]) RebuildAsync() <-chan struct{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.rebuildAsync()
+}
+
+// rebuildAsync starts the background rebuild, it must be called with the write
+// lock held
+func (t *Tree[T]) rebuildAsync() <-chan struct{} {
+	if t.rebuildDone != nil {
+		return t.rebuildDone
+	}
+	done := make(chan struct{})
+	t.rebuildDone = done
+
+	// Snapshot the live items, the slices are never modified in place so they
+	// can be read without the lock later
+	generation := t.generation
+	snapshot := len(t.items)
+	oldIndex := make([]int, 0, snapshot-len(t._deadIdx))
+	for i := 0; i < snapshot; i++ {
+		if !t.nodes[i]._dead {
+			oldIndex = append(oldIndex, i)
+		}
+	}
+	live, liveIDs := t.liveItems(snapshot)
+	next := &Tree[T]{
+		Distance:    t.Distance,
+		MaxChildren: t.leafSize(),
+	}
+
+	go func() {
+		defer close(done)
+
+		next.setItemsWithIDs(live, liveIDs)
+		if testHookRebuildBuilt != nil {
+			testHookRebuildBuilt()
+		}
+
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.rebuildDone = nil
+		if t.generation != generation {
+			return
+		}
+		t.swap(next, oldIndex, snapshot)
+	}()
+
+	return done
+}
+
+// swap replaces the index with next, built from the items at oldIndex, and
+// replays the changes made since the first snapshot items were copied
+func (t *Tree[T]) swap(next *Tree[T], oldIndex []int, snapshot int) {
+	previous, previousNodes, previousIDs := t.items, t.nodes, t.itemIDs
+
+	t.generation++
+	t.inserts, t.insertDepth = 0, 0
+	t.root = next.root
+	t.items = next.items
+	t.nodes = next.nodes
+	t.itemIDs = next.itemIDs
+	t.byID = next.byID
+	t._deadIdx = make([]int, 0)
+	if t.bind != nil {
+		for i, item := range t.items {
+			t.bind(item, t.nodes[i])
+		}
+	}
+
+	// Removals of copied items
+	for i, old := range oldIndex {
+		if previousNodes[old]._dead {
+			t.removeNode(t.nodes[i])
+		}
+	}
+
+	// Items inserted during the build that are still live
+	for i := snapshot; i < len(previous); i++ {
+		if !previousNodes[i]._dead {
+			id := ""
+			if previousIDs != nil {
+				id = previousIDs[i]
+			}
+			t.insert(previous[i], id)
+		}
+	}
+}
+
+// RebuildAsync rebuilds the index over the live items in the background and
+// swaps it in once built. See Tree.RebuildAsync.
+func (v *VPTree) RebuildAsync() <-chan struct{} {
+	return v.core().RebuildAsync()
+}
+
+// RebuildReason identifies which RebuildPolicy limit triggered a rebuild
+type RebuildReason int
+
+// Reasons for automatic rebuilds
+const (
+	RebuildDeadFraction RebuildReason = iota + 1
+	RebuildInserts
+	RebuildDepth
+)
+
+func (r RebuildReason) String() string {
+	switch r {
+	case RebuildDeadFraction:
+		return "dead fraction"
+	case RebuildInserts:
+		return "inserts"
+	case RebuildDepth:
+		return "depth"
+	}
+	return "unknown"
+}
+
+// RebuildEvent describes the state of the index when a RebuildPolicy
+// triggered a rebuild
+type RebuildEvent struct {
+	Reason RebuildReason
+	// Items is the number of items including those marked for removal
+	Items int
+	// Dead is the number of items marked for removal
+	Dead int
+	// Inserts is the number of items inserted since the last build
+	Inserts int
+	// Depth is the deepest level reached by an insert since the last build
+	Depth int
+
+	generation uint64
+}
+
+// RebuildPolicy makes a tree rebuild itself once removals or unbalanced
+// inserts have degraded the index. Zero fields disable their limit.
+type RebuildPolicy struct {
+	// MaxDeadFraction rebuilds when more than this fraction of the items are
+	// marked for removal
+	MaxDeadFraction float64
+	// MaxInserts rebuilds after this many inserts since the last build
+	MaxInserts int
+	// MaxDepthFactor rebuilds when an insert places an item deeper than
+	// MaxDepthFactor * log2(live items)
+	MaxDepthFactor float64
+	// Async rebuilds with RebuildAsync instead of blocking the Insert or Remove
+	// that triggered the rebuild
+	Async bool
+	// OnRebuild, if set, is called once a triggered rebuild has finished
+	OnRebuild func(RebuildEvent)
+}
+
+// SetRebuildPolicy replaces the policy used to rebuild the index
+// automatically after Insert and Remove
+func (t *Tree[T]) SetRebuildPolicy(policy RebuildPolicy) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.policy = policy
+}
+
+// checkPolicy returns the event for a rebuild the policy asks for, if any.
+// It must be called with the write lock held.
+func (t *Tree[T]) checkPolicy() *RebuildEvent {
+	p := &t.policy
+	if t.rebuildDone != nil || len(t.items) == 0 {
+		return nil
+	}
+
+	event := &RebuildEvent{
+		generation: t.generation,
+		Items:      len(t.items),
+		Dead:       len(t._deadIdx),
+		Inserts:    t.inserts,
+		Depth:      t.insertDepth,
+	}
+	live := event.Items - event.Dead
+
+	switch {
+	case p.MaxDeadFraction > 0 && float64(event.Dead)/float64(event.Items) > p.MaxDeadFraction:
+		event.Reason = RebuildDeadFraction
+	case p.MaxInserts > 0 && event.Inserts >= p.MaxInserts:
+		event.Reason = RebuildInserts
+	case p.MaxDepthFactor > 0 && live > 1 && float64(event.Depth) > p.MaxDepthFactor*math.Log2(float64(live)):
+		event.Reason = RebuildDepth
+	default:
+		return nil
+	}
+	return event
+}
+
+// applyPolicy runs the rebuild for event unless the index was rebuilt since
+// the event was created. It must be called without the lock held.
+func (t *Tree[T]) applyPolicy(event *RebuildEvent) {
+	if event == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	policy := t.policy
+	if t.generation != event.generation || t.rebuildDone != nil {
+		t.mutex.Unlock()
+		return
+	}
+	if policy.Async {
+		done := t.rebuildAsync()
+		t.mutex.Unlock()
+		if policy.OnRebuild != nil {
+			go func() {
+				<-done
+				policy.OnRebuild(*event)
+			}()
+		}
+		return
+	}
+	t.rebuild()
+	t.mutex.Unlock()
+
+	if policy.OnRebuild != nil {
+		policy.OnRebuild(*event)
+	}
+}
+
+// SetRebuildPolicy replaces the policy used to rebuild the index
+// automatically after Insert and Remove
+func (v *VPTree) SetRebuildPolicy(policy RebuildPolicy) {
+	v.core().SetRebuildPolicy(policy)
+}
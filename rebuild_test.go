@@ -0,0 +1,222 @@
+package search
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVPTreeRebuildAsyncReplaysChanges(t *testing.T) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+	tree.MaxChildren = 4
+
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			points = append(points, &Point{
+				Lat:  float64(i),
+				Lon:  float64(j),
+				Date: i + j})
+		}
+	}
+	tree.SetItems(points)
+
+	removedBefore := points[3].(*Point)
+	tree.Remove(removedBefore)
+
+	built := make(chan struct{})
+	release := make(chan struct{})
+	testHookRebuildBuilt = func() {
+		close(built)
+		<-release
+	}
+	defer func() { testHookRebuildBuilt = nil }()
+
+	done := tree.RebuildAsync()
+	if again := tree.RebuildAsync(); again != done {
+		t.Fatal("Concurrent RebuildAsync calls should share one rebuild")
+	}
+	<-built
+
+	// The old index keeps serving and accepting changes during the build
+	removedDuring := points[50].(*Point)
+	tree.Remove(removedDuring)
+	inserted := &Point{Lat: 5.5, Lon: 5.5}
+	tree.Insert(inserted)
+	insertedRemoved := &Point{Lat: 6.5, Lon: 6.5}
+	tree.Insert(insertedRemoved)
+	tree.Remove(insertedRemoved)
+
+	results, distances := tree.Search(inserted, 1)
+	if len(results) != 1 || results[0] != VPTreeItem(inserted) || distances[0] != 0 {
+		t.Fatal("Item inserted during the build not found before swap")
+	}
+
+	close(release)
+	<-done
+
+	if n := tree.ItemCount(); n != 400 {
+		t.Fatal("Expected 400 items after rebuild, got", n)
+	}
+
+	results, distances = tree.Search(inserted, 1)
+	if len(results) != 1 || results[0] != VPTreeItem(inserted) || distances[0] != 0 {
+		t.Fatal("Item inserted during the build not found after swap")
+	}
+	if inserted.GetNode() == nil || !tree.core().owns(inserted.GetNode()) {
+		t.Fatal("Inserted item not bound to the new index")
+	}
+
+	for _, removed := range []*Point{removedBefore, removedDuring, insertedRemoved} {
+		results, distances = tree.Search(removed, 1)
+		if len(results) != 1 || results[0] == VPTreeItem(removed) || distances[0] == 0 {
+			t.Fatal("Removed item returned after swap", removed)
+		}
+	}
+
+	for _, item := range points {
+		p := item.(*Point)
+		if p == removedBefore || p == removedDuring {
+			continue
+		}
+		results, distances = tree.Search(p, 1)
+		if len(results) != 1 || results[0] != item || distances[0] != 0 {
+			t.Fatal("Item not found after swap", p)
+		}
+		if !tree.core().owns(p.GetNode()) {
+			t.Fatal("Item not bound to the new index", p)
+		}
+	}
+
+	// Removing through the bound node works on the new index
+	tree.Remove(points[0])
+	tree.Rebuild()
+	if n := tree.ItemCount(); n != 398 {
+		t.Fatal("Expected 398 items after removal and rebuild, got", n)
+	}
+}
+
+func TestTreeRebuildAsyncSuperseded(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(10))
+
+	built := make(chan struct{})
+	release := make(chan struct{})
+	testHookRebuildBuilt = func() {
+		close(built)
+		<-release
+	}
+	defer func() { testHookRebuildBuilt = nil }()
+
+	done := tree.RebuildAsync()
+	<-built
+	tree.SetItems(gridCities(3))
+	close(release)
+	<-done
+
+	if n := tree.ItemCount(); n != 9 {
+		t.Fatal("Superseded rebuild replaced the index, got", n, "items")
+	}
+}
+
+func TestRebuildPolicyDeadFraction(t *testing.T) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			points = append(points, &Point{Lat: float64(i), Lon: float64(j)})
+		}
+	}
+	tree.SetItems(points)
+
+	events := make([]RebuildEvent, 0)
+	tree.SetRebuildPolicy(RebuildPolicy{
+		MaxDeadFraction: 0.1,
+		OnRebuild: func(e RebuildEvent) {
+			events = append(events, e)
+		},
+	})
+
+	for i := 0; i < 10; i++ {
+		tree.Remove(points[i])
+	}
+	if len(events) != 0 || tree.ItemCount() != 100 {
+		t.Fatal("Rebuilt before the dead fraction was exceeded")
+	}
+
+	tree.Remove(points[10])
+	if len(events) != 1 {
+		t.Fatal("Expected 1 rebuild, got", len(events))
+	}
+	e := events[0]
+	if e.Reason != RebuildDeadFraction || e.Items != 100 || e.Dead != 11 {
+		t.Fatal("Unexpected event", e)
+	}
+	if tree.ItemCount() != 89 {
+		t.Fatal("Expected 89 items after rebuild, got", tree.ItemCount())
+	}
+}
+
+func TestRebuildPolicyInsertsAsync(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(10))
+
+	events := make(chan RebuildEvent, 1)
+	tree.SetRebuildPolicy(RebuildPolicy{
+		MaxInserts: 25,
+		Async:      true,
+		OnRebuild: func(e RebuildEvent) {
+			events <- e
+		},
+	})
+
+	for i := 0; i < 25; i++ {
+		tree.Insert(city{Lat: 0.5 + float64(i)/10, Lon: 0.5})
+	}
+
+	e := <-events
+	if e.Reason != RebuildInserts || e.Inserts != 25 {
+		t.Fatal("Unexpected event", e)
+	}
+
+	tree.mutex.RLock()
+	inserts := tree.inserts
+	tree.mutex.RUnlock()
+	if inserts != 0 {
+		t.Fatal("Insert count not reset by rebuild, got", inserts)
+	}
+	if tree.ItemCount() != 125 {
+		t.Fatal("Expected 125 items, got", tree.ItemCount())
+	}
+}
+
+func TestRebuildPolicyDepth(t *testing.T) {
+	tree := Tree[float64]{Distance: func(a, b float64) float64 {
+		return math.Abs(a - b)
+	}}
+	tree.SetItems([]float64{0, 1, 2, 3, 4, 5, 6, 7})
+
+	var fired []RebuildEvent
+	tree.SetRebuildPolicy(RebuildPolicy{
+		MaxDepthFactor: 3,
+		OnRebuild: func(e RebuildEvent) {
+			fired = append(fired, e)
+		},
+	})
+
+	// Increasing values always descend to the right and degenerate the tree
+	for i := 8; i < 200 && len(fired) == 0; i++ {
+		tree.Insert(float64(i))
+	}
+	if len(fired) != 1 || fired[0].Reason != RebuildDepth {
+		t.Fatal("Expected a depth rebuild, got", fired)
+	}
+	live := fired[0].Items - fired[0].Dead
+	if float64(fired[0].Depth) <= 3*math.Log2(float64(live)) {
+		t.Fatal("Rebuild fired below the depth limit", fired[0])
+	}
+}
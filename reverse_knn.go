@@ -0,0 +1,112 @@
+package search
+
+import (
+	"container/heap"
+)
+
+// ReverseKNN returns the items that would have the target among their k
+// nearest neighbors, sorted by distance to the target ascending. The second
+// parameter is the respective distances to the target. An item qualifies when
+// fewer than k other live items are strictly closer to it than the target is.
+// Affinity is not applied.
+func (t *Tree[T]) ReverseKNN(target T, k int) ([]T, []float64) {
+	if k <= 0 {
+		return []T{}, []float64{}
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	r := reverseSearcher[T]{tree: t, target: target, k: k}
+	if t.root != nil {
+		r.search(nodeRegion{node: t.root})
+	}
+
+	results := make([]T, r.pq.Len())
+	distances := make([]float64, r.pq.Len())
+	for i := r.pq.Len() - 1; i >= 0; i-- {
+		item := heap.Pop(&r.pq).(*vpHeapItem)
+		results[i] = t.items[item.index]
+		distances[i] = item.Priority()
+	}
+
+	return results, distances
+}
+
+// reverseSearcher holds the state of a single reverse nearest neighbor search
+type reverseSearcher[T any] struct {
+	tree   *Tree[T]
+	target T
+	k      int
+	pq     PriorityQueue
+}
+
+// search checks every item of the region. Items of a region lie within twice
+// its radius of each other, when the target is farther than that from every
+// item and the region holds more than k live items none of them qualifies.
+func (r *reverseSearcher[T]) search(region nodeRegion) {
+	t := r.tree
+	node := region.node
+	dist := t.Distance(t.items[node.index], r.target)
+
+	radius := region.radius()
+	if !region.single && dist-radius > 2*radius && t.liveAtLeast(node, r.k+1) {
+		return
+	}
+
+	if !node._dead && (t.skip == nil || !t.skip(t.items[node.index], r.target)) {
+		r.check(node, dist)
+	}
+	if !region.single {
+		region.split(t.nodes, r.search)
+	}
+}
+
+// check adds the node's item to the results when fewer than k other items are
+// closer to it than dist
+func (r *reverseSearcher[T]) check(node *VPTreeNode, dist float64) {
+	t := r.tree
+	s := t.newSearcher(t.items[node.index], 0, dist)
+	s.countOnly = true
+	s.limit = r.k
+	s.self = node
+	s.search(t.root)
+
+	if s.count < r.k {
+		heap.Push(&r.pq, &vpHeapItem{index: node.index, dist: dist, node: node})
+	}
+}
+
+// liveAtLeast reports if the subtree below node holds at least n live items
+// including the node's own
+func (t *Tree[T]) liveAtLeast(node *VPTreeNode, n int) bool {
+	count := 0
+	var walk func(node *VPTreeNode) bool
+	walk = func(node *VPTreeNode) bool {
+		if node == nil {
+			return false
+		}
+		if !node._dead {
+			count++
+		}
+		if count >= n {
+			return true
+		}
+		if node.isLeaf {
+			for _, idx := range node.children {
+				if !t.nodes[idx]._dead {
+					count++
+				}
+			}
+			return count >= n
+		}
+		return walk(node.left) || walk(node.right)
+	}
+	return walk(node)
+}
+
+// ReverseKNN returns the items that would have the target among their k
+// nearest neighbors, see Tree.ReverseKNN
+func (v *VPTree) ReverseKNN(target VPTreeItem, k int) ([]VPTreeItem, []float64) {
+	return v.core().ReverseKNN(target, k)
+}
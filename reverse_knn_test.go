@@ -0,0 +1,88 @@
+package search
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// bruteReverseKNN returns the live items with fewer than k other live items
+// strictly closer to them than the target
+func bruteReverseKNN(tree *Tree[city], target city, k int) map[city]float64 {
+	want := make(map[city]float64)
+	items := tree.Items()
+	for i, x := range items {
+		if tree.nodes[i]._dead {
+			continue
+		}
+		dist := cityDistance(x, target)
+		closer := 0
+		for j, y := range items {
+			if j != i && !tree.nodes[j]._dead && cityDistance(x, y) < dist {
+				closer++
+			}
+		}
+		if closer < k {
+			want[x] = dist
+		}
+	}
+	return want
+}
+
+func TestTreeReverseKNNMatchesBruteForce(t *testing.T) {
+	for _, size := range []int{0, 6} {
+		customers := make([]city, 400)
+		for i := range customers {
+			customers[i] = city{Lat: rand.Float64() * 10, Lon: rand.Float64() * 10}
+		}
+		tree := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		tree.SetItems(customers)
+		for i := 0; i < 20; i++ {
+			tree.Insert(city{Lat: rand.Float64() * 10, Lon: rand.Float64() * 10})
+		}
+		tree.Remove(customers[0])
+		tree.Remove(customers[1])
+
+		for _, k := range []int{1, 3, 10} {
+			for i := 0; i < 5; i++ {
+				store := city{Lat: rand.Float64() * 10, Lon: rand.Float64() * 10}
+				want := bruteReverseKNN(&tree, store, k)
+
+				results, distances := tree.ReverseKNN(store, k)
+				if len(results) != len(want) {
+					t.Fatal("Expected", len(want), "results for k", k, "got", len(results))
+				}
+				for j, c := range results {
+					d, ok := want[c]
+					if !ok || d != distances[j] {
+						t.Fatal("Unexpected result", c, "at", distances[j])
+					}
+					if j > 0 && distances[j] < distances[j-1] {
+						t.Fatal("Distances not ascending", distances)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestVPTreeReverseKNNPrunes(t *testing.T) {
+	distancer := &countingDistancer{}
+	tree := searchContextTree(distancer)
+
+	distancer.calls = 0
+	results, _ := tree.ReverseKNN(&Point{Lat: 0.1, Lon: 0.2}, 1)
+	// The corner and its two neighbors are closer to the target than to any
+	// other point
+	if len(results) != 3 {
+		t.Fatal("Expected 3 results, got", len(results))
+	}
+	for _, r := range results {
+		if p := r.(*Point); p.Lat+p.Lon > 1 {
+			t.Fatal("Returned", p, "expected a corner point")
+		}
+	}
+	n := tree.ItemCount()
+	if distancer.calls >= 2*n {
+		t.Fatal("ReverseKNN made", distancer.calls, "distance calls for", n, "items")
+	}
+}
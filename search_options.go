@@ -0,0 +1,155 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// ErrBudgetExceeded is returned when a search stops because it reached its
+// maximum number of distance evaluations
+var ErrBudgetExceeded = errors.New("search: distance evaluation budget exceeded")
+
+// SearchOptions configures a search started with SearchContext. The zero value
+// searches without any limits.
+type SearchOptions[T any] struct {
+	// MaxDist limits the results to items closer than MaxDist to the target,
+	// zero means no limit
+	MaxDist float64
+	// MaxDistanceEvaluations stops the search after this many distance
+	// calculations, zero means no limit
+	MaxDistanceEvaluations int
+
+	// Epsilon makes the search approximate. Subtrees are pruned as if the
+	// current kth distance was tau/(1+Epsilon), every result is then within
+	// a factor of 1+Epsilon of the true kth nearest distance. Zero searches
+	// exactly.
+	Epsilon float64
+	// MaxVisited stops the search after visiting this many tree nodes and
+	// returns the best results found so far without an error, zero means no
+	// limit. A leaf bucket counts as a single node.
+	MaxVisited int
+
+	// Filter returns if the item may be included in the results. It replaces
+	// the item's ShouldSkip for a VPTree when set.
+	Filter func(item T) bool
+	// Rescore returns the score an item is ranked and returned by instead of
+	// its distance. It replaces the item's ApplyAffinity for a VPTree when
+	// set.
+	//
+	// Subtrees are pruned by the raw distances from the tree's bounds against
+	// the score of the kth result. The results are exact as long as the
+	// scores stay within RescoreBounds. A score below them can hide items in
+	// pruned subtrees and those results are best effort.
+	Rescore func(item T, dist float64) float64
+	// RescoreBounds declares how far Rescore may lower a score below the
+	// distance. The zero value declares scores are never less than the
+	// distance, for example when Rescore only adds penalties.
+	RescoreBounds ScoreBounds
+
+	// Stats is filled in with the work done by the search when set
+	Stats *SearchStats
+}
+
+// ScoreBounds declares the lowest score an item at some distance can have,
+// MinFactor*dist - MaxBoost. Searches ranking by score prune subtrees which
+// can hold no item scoring below the kth result within these bounds, so boosts
+// up to the declared amount keep the results exact. Larger bounds prune less.
+type ScoreBounds struct {
+	// MinFactor is the smallest factor a distance is scaled by, values of 0
+	// or less are treated as 1
+	MinFactor float64
+	// MaxBoost is the largest amount subtracted from a scaled distance
+	MaxBoost float64
+}
+
+// radius returns the distance from the target beyond which no item can score
+// below tau
+func (b ScoreBounds) radius(tau float64) float64 {
+	factor := b.MinFactor
+	if factor <= 0 {
+		factor = 1
+	}
+	if b.MaxBoost == 0 && factor == 1 {
+		return tau
+	}
+	return (tau + b.MaxBoost) / factor
+}
+
+// SearchContext returns the nearest k items to the target like SearchInRange,
+// but stops early when ctx is done or the options budget is used up. In that
+// case the best results found so far are returned together with ctx.Err() or
+// ErrBudgetExceeded.
+func (t *Tree[T]) SearchContext(ctx context.Context, target T, k int, opts SearchOptions[T]) ([]T, []float64, error) {
+	if err := ctx.Err(); err != nil {
+		return []T{}, []float64{}, err
+	}
+	if k <= 0 {
+		return []T{}, []float64{}, nil
+	}
+
+	maxDist := opts.MaxDist
+	if maxDist <= 0 {
+		maxDist = math.MaxFloat64
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	s := t.newSearcher(target, k, maxDist)
+	s.useAffinity()
+	s.ctx = ctx
+	s.done = ctx.Done()
+	s.budget = opts.MaxDistanceEvaluations
+	s.epsilon = opts.Epsilon
+	s.maxVisited = opts.MaxVisited
+	s.filter = opts.Filter
+	if opts.Rescore != nil {
+		s.rescore = opts.Rescore
+		s.bounds = opts.RescoreBounds
+	}
+	s.search(t.root)
+	t.record(&s)
+	if opts.Stats != nil {
+		*opts.Stats = s.stats()
+	}
+
+	results, distances := s.results()
+	return results, distances, s.err
+}
+
+// halted reports if the search has to stop, recording the reason
+func (s *searcher[T]) halted() bool {
+	if s.err != nil {
+		return true
+	}
+	if s.maxVisited > 0 && s.visited >= s.maxVisited {
+		return true
+	}
+	if s.limit > 0 && s.count >= s.limit {
+		return true
+	}
+	if s.budget > 0 && s.evals >= s.budget {
+		s.err = ErrBudgetExceeded
+		return true
+	}
+	if s.done != nil {
+		select {
+		case <-s.done:
+			s.err = s.ctx.Err()
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// radius returns the raw distance subtrees are pruned at, tau widened by the
+// score bounds and shrunk by epsilon for approximate searches
+func (s *searcher[T]) radius() float64 {
+	radius := s.bounds.radius(s.tau)
+	if s.epsilon > 0 {
+		return radius / (1 + s.epsilon)
+	}
+	return radius
+}
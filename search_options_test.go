@@ -0,0 +1,231 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+)
+
+type countingDistancer struct {
+	PointDistancer
+	calls  int
+	cancel context.CancelFunc
+	after  int
+}
+
+func (c *countingDistancer) Distance(a, b VPTreeItem) float64 {
+	c.calls++
+	if c.cancel != nil && c.calls == c.after {
+		c.cancel()
+	}
+	return c.PointDistancer.Distance(a, b)
+}
+
+func searchContextTree(distancer VPTreeDistancer) *VPTree {
+	tree := &VPTree{Distancer: distancer}
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 30; j++ {
+			points = append(points, &Point{
+				Lat:  float64(i),
+				Lon:  float64(j),
+				Date: i + j})
+		}
+	}
+	tree.SetItems(points)
+	return tree
+}
+
+func TestSearchContextMatchesSearch(t *testing.T) {
+	var distancer PointDistancer
+	tree := searchContextTree(&distancer)
+
+	target := &Point{Lat: 12.3, Lon: 4.5}
+	want, wantDist := tree.Search(target, 5)
+	got, gotDist, err := tree.SearchContext(context.Background(), target, 5, SearchOptions[VPTreeItem]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatal("Expected", len(want), "results, got", len(got))
+	}
+	for i := range want {
+		if want[i] != got[i] || wantDist[i] != gotDist[i] {
+			t.Fatal("Returned", got[i], "expected", want[i])
+		}
+	}
+}
+
+func TestSearchContextBudget(t *testing.T) {
+	distancer := &countingDistancer{}
+	tree := searchContextTree(distancer)
+
+	distancer.calls = 0
+	results, distances, err := tree.SearchContext(context.Background(), &Point{Lat: 12.3, Lon: 4.5}, 5, SearchOptions[VPTreeItem]{
+		MaxDistanceEvaluations: 10,
+	})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatal("Expected ErrBudgetExceeded, got", err)
+	}
+	if distancer.calls > 10 {
+		t.Fatal("Search made", distancer.calls, "distance calls with a budget of 10")
+	}
+	if len(results) != 5 || len(distances) != 5 {
+		t.Fatal("Expected the best 5 results found so far, got", len(results))
+	}
+	for i := 1; i < len(distances); i++ {
+		if distances[i] < distances[i-1] {
+			t.Fatal("Distances not ascending", distances)
+		}
+	}
+}
+
+func TestSearchContextCancel(t *testing.T) {
+	distancer := &countingDistancer{}
+	tree := searchContextTree(distancer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	distancer.calls = 0
+	distancer.cancel = cancel
+	distancer.after = 3
+
+	_, _, err := tree.SearchContext(ctx, &Point{Lat: 12.3, Lon: 4.5}, 5, SearchOptions[VPTreeItem]{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("Expected context.Canceled, got", err)
+	}
+	if distancer.calls != 3 {
+		t.Fatal("Search continued for", distancer.calls, "distance calls after cancellation")
+	}
+
+	results, _, err := tree.SearchContext(ctx, &Point{Lat: 1, Lon: 1}, 5, SearchOptions[VPTreeItem]{})
+	if !errors.Is(err, context.Canceled) || len(results) != 0 {
+		t.Fatal("Expected no results from cancelled context, got", results, err)
+	}
+}
+
+func TestSearchContextApproximate(t *testing.T) {
+	distancer := &countingDistancer{}
+	tree := searchContextTree(distancer)
+
+	target := &Point{Lat: 12.3, Lon: 4.4}
+	distancer.calls = 0
+	_, exact := tree.Search(target, 10)
+	exactCalls := distancer.calls
+
+	distancer.calls = 0
+	results, distances, err := tree.SearchContext(context.Background(), target, 10, SearchOptions[VPTreeItem]{
+		Epsilon: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 10 {
+		t.Fatal("Expected 10 results, got", len(results))
+	}
+	for i := range distances {
+		if distances[i] > 2*exact[len(exact)-1] {
+			t.Fatal("Result", i, "at", distances[i], "further than 1+eps times the exact", exact[len(exact)-1])
+		}
+	}
+	if distancer.calls > exactCalls {
+		t.Fatal("Approximate search made", distancer.calls, "distance calls, exact made", exactCalls)
+	}
+
+	distancer.calls = 0
+	results, _, err = tree.SearchContext(context.Background(), target, 10, SearchOptions[VPTreeItem]{
+		MaxVisited: 20,
+	})
+	if err != nil {
+		t.Fatal("MaxVisited should not return an error, got", err)
+	}
+	if len(results) == 0 || distancer.calls > 20 {
+		t.Fatal("Expected results from at most 20 nodes, got", len(results), "with", distancer.calls, "distance calls")
+	}
+}
+
+// skippedPoint is skipped by every search unless a filter replaces ShouldSkip
+type skippedPoint struct {
+	Point
+}
+
+func (p *skippedPoint) ShouldSkip(target VPTreeItem) bool {
+	return true
+}
+
+type skippedPointDistancer struct {
+}
+
+func (d *skippedPointDistancer) Distance(a, b VPTreeItem) float64 {
+	point := func(item VPTreeItem) *Point {
+		if s, ok := item.(*skippedPoint); ok {
+			return &s.Point
+		}
+		return item.(*Point)
+	}
+	p1, p2 := point(a), point(b)
+	return HaversineEarth(p1.Lat, p1.Lon, p2.Lat, p2.Lon)
+}
+
+func TestSearchContextFilterAndRescore(t *testing.T) {
+	var distancer PointDistancer
+	tree := searchContextTree(&distancer)
+	target := &Point{Lat: 12.3, Lon: 4.4}
+
+	// Only points with an even date, a different filter per query
+	results, _, err := tree.SearchContext(context.Background(), target, 5, SearchOptions[VPTreeItem]{
+		Filter: func(item VPTreeItem) bool {
+			return item.(*Point).Date%2 == 0
+		},
+	})
+	if err != nil || len(results) != 5 {
+		t.Fatal("Expected 5 results, got", len(results), err)
+	}
+	for _, r := range results {
+		if r.(*Point).Date%2 != 0 {
+			t.Fatal("Filtered point returned", r)
+		}
+	}
+
+	// Penalize points west of the target, the scores stay above the distance
+	// so the results are exact
+	rescore := func(item VPTreeItem, dist float64) float64 {
+		if item.(*Point).Lon < 4.4 {
+			return dist + 200000
+		}
+		return dist
+	}
+	results, scores, err := tree.SearchContext(context.Background(), target, 8, SearchOptions[VPTreeItem]{
+		Rescore: rescore,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]float64, 0)
+	for _, item := range tree.Items() {
+		want = append(want, rescore(item, distancer.Distance(item, target)))
+	}
+	sort.Float64s(want)
+	for i := range results {
+		if scores[i] != want[i] {
+			t.Fatal("Result", i, "scored", scores[i], "expected", want[i])
+		}
+		if scores[i] != rescore(results[i], distancer.Distance(results[i], target)) {
+			t.Fatal("Returned score", scores[i], "for", results[i])
+		}
+	}
+
+	// A filter replaces the item's ShouldSkip
+	skipped := &VPTree{Distancer: &skippedPointDistancer{}}
+	skipped.SetItems([]VPTreeItem{&skippedPoint{Point{Lat: 1, Lon: 1}}, &skippedPoint{Point{Lat: 2, Lon: 2}}})
+	if results, _ := skipped.Search(target, 2); len(results) != 0 {
+		t.Fatal("Skipped points returned", results)
+	}
+	results, _, _ = skipped.SearchContext(context.Background(), target, 2, SearchOptions[VPTreeItem]{
+		Filter: func(VPTreeItem) bool { return true },
+	})
+	if len(results) != 2 {
+		t.Fatal("Expected 2 results with a filter, got", len(results))
+	}
+}
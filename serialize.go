@@ -0,0 +1,438 @@
+package search
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// Serialized trees start with a magic header followed by the format version
+const (
+	treeMagic         = "VPTR"
+	treeFormatVersion = uint32(1)
+
+	// maxEncodedItemSize guards against allocating absurd buffers when reading
+	// a corrupt stream
+	maxEncodedItemSize = 1 << 30
+	// readChunkSize is the most a length read from the stream allocates
+	// before the data behind it has arrived
+	readChunkSize = 1 << 16
+)
+
+const (
+	nodeAbsent byte = iota
+	nodePresent
+)
+
+// Node flags
+const (
+	nodeDead byte = 1 << iota
+	nodeLeaf
+)
+
+var (
+	// ErrInvalidFormat is returned when reading data that is not a serialized
+	// tree or is corrupt
+	ErrInvalidFormat = errors.New("search: invalid tree format")
+	// ErrUnsupportedVersion is returned when reading a tree written with
+	// another format version
+	ErrUnsupportedVersion = errors.New("search: unsupported tree format version")
+	// ErrNotMarshaler is returned by WriteTo when an item does not implement
+	// encoding.BinaryMarshaler
+	ErrNotMarshaler = errors.New("search: item does not implement encoding.BinaryMarshaler")
+)
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteTo saves the tree to w. Every item must implement
+// encoding.BinaryMarshaler, use Encode to provide the encoding separately.
+func (t *Tree[T]) WriteTo(w io.Writer) (int64, error) {
+	return t.Encode(w, func(item T) ([]byte, error) {
+		m, ok := any(item).(encoding.BinaryMarshaler)
+		if !ok {
+			return nil, ErrNotMarshaler
+		}
+		return m.MarshalBinary()
+	})
+}
+
+// Encode saves the node structure of the tree and the items, encoded with the
+// encode function, to w so it can be loaded again with ReadTree without
+// recomputing any distances. It returns the number of bytes written.
+func (t *Tree[T]) Encode(w io.Writer, encode func(T) ([]byte, error)) (int64, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	enc := treeEncoder{w: bw, nodes: t.nodes}
+
+	enc.bytes([]byte(treeMagic))
+	enc.uint32(treeFormatVersion)
+	enc.uint64(uint64(len(t.items)))
+	for _, item := range t.items {
+		if enc.err != nil {
+			break
+		}
+		data, err := encode(item)
+		if err != nil {
+			return cw.n, err
+		}
+		enc.uint32(uint32(len(data)))
+		enc.bytes(data)
+	}
+	if t.itemIDs == nil {
+		enc.byte(0)
+	} else {
+		enc.byte(1)
+		for _, id := range t.itemIDs {
+			enc.uint32(uint32(len(id)))
+			enc.bytes([]byte(id))
+		}
+	}
+	enc.node(t.root)
+
+	if enc.err == nil {
+		enc.err = bw.Flush()
+	}
+	return cw.n, enc.err
+}
+
+type treeEncoder struct {
+	w     *bufio.Writer
+	buf   [8]byte
+	nodes []*VPTreeNode
+	err   error
+}
+
+func (e *treeEncoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *treeEncoder) byte(b byte) {
+	if e.err == nil {
+		e.err = e.w.WriteByte(b)
+	}
+}
+
+func (e *treeEncoder) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(e.buf[:4], v)
+	e.bytes(e.buf[:4])
+}
+
+func (e *treeEncoder) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:], v)
+	e.bytes(e.buf[:])
+}
+
+func (e *treeEncoder) float64(v float64) {
+	e.uint64(math.Float64bits(v))
+}
+
+// node writes the subtree in pre-order
+func (e *treeEncoder) node(n *VPTreeNode) {
+	if e.err != nil {
+		return
+	}
+	if n == nil {
+		e.byte(nodeAbsent)
+		return
+	}
+	e.byte(nodePresent)
+	e.uint64(uint64(n.index))
+	e.float64(n.threshold)
+	e.float64(n.m)
+	e.float64(n.M)
+	var flags byte
+	if n._dead {
+		flags |= nodeDead
+	}
+	if n.isLeaf {
+		flags |= nodeLeaf
+	}
+	e.byte(flags)
+	if n.isLeaf {
+		e.uint32(uint32(len(n.children)))
+		for _, idx := range n.children {
+			e.uint64(uint64(idx))
+			if e.nodes[idx]._dead {
+				e.byte(nodeDead)
+			} else {
+				e.byte(0)
+			}
+		}
+	}
+	e.node(n.left)
+	e.node(n.right)
+}
+
+// ReadTree loads a tree saved with Encode or WriteTo. The decode function
+// reverses the item encoding. The Distance function of the returned tree must
+// be set before it is searched or modified.
+func ReadTree[T any](r io.Reader, decode func([]byte) (T, error)) (*Tree[T], error) {
+	var t Tree[T]
+	if err := t.readFrom(r, decode); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ReadVPTree loads a VPTree saved with WriteTo. The decode function reverses
+// the items MarshalBinary encoding. The Distancer of the returned tree must be
+// set before it is searched or modified.
+func ReadVPTree(r io.Reader, decode func([]byte) (VPTreeItem, error)) (*VPTree, error) {
+	var v VPTree
+	if err := v.core().readFrom(r, decode); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (t *Tree[T]) readFrom(r io.Reader, decode func([]byte) (T, error)) error {
+	dec := treeDecoder{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(treeMagic))
+	dec.bytes(magic)
+	if dec.err == nil && string(magic) != treeMagic {
+		return ErrInvalidFormat
+	}
+	version := dec.uint32()
+	if dec.err == nil && version != treeFormatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	count := dec.uint64()
+	if dec.err != nil {
+		return dec.err
+	}
+	if count > math.MaxInt32 {
+		return ErrInvalidFormat
+	}
+
+	// The count comes from the stream, items only grow as they are read
+	items := make([]T, 0, min(count, 1<<16))
+	var data []byte
+	for i := uint64(0); i < count; i++ {
+		size := dec.uint32()
+		if dec.err != nil {
+			return dec.err
+		}
+		if size > maxEncodedItemSize {
+			return ErrInvalidFormat
+		}
+		data = dec.sized(data, size)
+		if dec.err != nil {
+			return dec.err
+		}
+		item, err := decode(data)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	var ids []string
+	if dec.byte() != 0 {
+		ids = make([]string, len(items))
+		var id []byte
+		for i := range ids {
+			size := dec.uint32()
+			if dec.err == nil && size > maxEncodedItemSize {
+				return ErrInvalidFormat
+			}
+			if dec.err != nil {
+				return dec.err
+			}
+			id = dec.sized(id, size)
+			ids[i] = string(id)
+		}
+	}
+	if dec.err != nil {
+		return dec.err
+	}
+
+	dec.nodes = make([]*VPTreeNode, len(items))
+	root := dec.node()
+	if dec.err != nil {
+		return dec.err
+	}
+	for _, node := range dec.nodes {
+		if node == nil {
+			return ErrInvalidFormat
+		}
+	}
+	var byID map[string]int
+	if ids != nil {
+		byID = make(map[string]int, len(ids))
+		for i, id := range ids {
+			if id == "" || dec.nodes[i]._dead {
+				continue
+			}
+			if _, ok := byID[id]; ok {
+				return ErrInvalidFormat
+			}
+			byID[id] = i
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.generation++
+	t.inserts, t.insertDepth = 0, 0
+	t.items = items
+	t.nodes = dec.nodes
+	t.root = root
+	t._deadIdx = make([]int, 0)
+	t.itemIDs, t.byID = ids, byID
+	for i, node := range dec.nodes {
+		if node._dead {
+			t._deadIdx = append(t._deadIdx, i)
+		}
+		if t.bind != nil {
+			t.bind(items[i], node)
+		}
+	}
+	return nil
+}
+
+type treeDecoder struct {
+	r     *bufio.Reader
+	buf   [8]byte
+	nodes []*VPTreeNode
+	err   error
+}
+
+func (d *treeDecoder) bytes(b []byte) {
+	if d.err == nil {
+		_, d.err = io.ReadFull(d.r, b)
+		if d.err == io.EOF {
+			d.err = io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// sized reads size bytes reusing buf. The buffer grows in chunks as the data
+// arrives, so a corrupt length cannot allocate more than the stream holds.
+func (d *treeDecoder) sized(buf []byte, size uint32) []byte {
+	buf = buf[:0]
+	for d.err == nil && len(buf) < int(size) {
+		n := min(int(size)-len(buf), readChunkSize)
+		buf = slices.Grow(buf, n)
+		d.bytes(buf[len(buf) : len(buf)+n])
+		buf = buf[:len(buf)+n]
+	}
+	return buf
+}
+
+func (d *treeDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	var b byte
+	b, d.err = d.r.ReadByte()
+	if d.err == io.EOF {
+		d.err = io.ErrUnexpectedEOF
+	}
+	return b
+}
+
+func (d *treeDecoder) uint32() uint32 {
+	d.bytes(d.buf[:4])
+	return binary.LittleEndian.Uint32(d.buf[:4])
+}
+
+func (d *treeDecoder) uint64() uint64 {
+	d.bytes(d.buf[:])
+	return binary.LittleEndian.Uint64(d.buf[:])
+}
+
+func (d *treeDecoder) float64() float64 {
+	return math.Float64frombits(d.uint64())
+}
+
+// claim records node as the node for the item index, each item may only be
+// referenced once
+func (d *treeDecoder) claim(index uint64, node *VPTreeNode) int {
+	if d.err != nil {
+		return 0
+	}
+	if index >= uint64(len(d.nodes)) || d.nodes[index] != nil {
+		d.err = ErrInvalidFormat
+		return 0
+	}
+	d.nodes[index] = node
+	return int(index)
+}
+
+func (d *treeDecoder) node() *VPTreeNode {
+	switch d.byte() {
+	case nodeAbsent:
+		return nil
+	case nodePresent:
+	default:
+		if d.err == nil {
+			d.err = ErrInvalidFormat
+		}
+		return nil
+	}
+
+	var n VPTreeNode
+	index := d.uint64()
+	n.threshold = d.float64()
+	n.m = d.float64()
+	n.M = d.float64()
+	flags := d.byte()
+	n._dead = flags&nodeDead != 0
+	n.isLeaf = flags&nodeLeaf != 0
+	n.index = d.claim(index, &n)
+	if d.err != nil {
+		return nil
+	}
+
+	if n.isLeaf {
+		count := d.uint32()
+		if d.err == nil && uint64(count) > uint64(len(d.nodes)) {
+			d.err = ErrInvalidFormat
+		}
+		if d.err != nil {
+			return nil
+		}
+		n.children = make([]int, count)
+		for i := range n.children {
+			child := &VPTreeNode{}
+			childIndex := d.uint64()
+			child._dead = d.byte()&nodeDead != 0
+			child.index = d.claim(childIndex, child)
+			if d.err != nil {
+				return nil
+			}
+			n.children[i] = child.index
+		}
+	}
+
+	n.left = d.node()
+	n.right = d.node()
+	return &n
+}
+
+// WriteTo saves the tree to w. Every item must implement
+// encoding.BinaryMarshaler.
+func (v *VPTree) WriteTo(w io.Writer) (int64, error) {
+	return v.core().WriteTo(w)
+}
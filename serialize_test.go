@@ -0,0 +1,185 @@
+package search
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"testing"
+)
+
+func (p *Point) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 24)
+	binary.LittleEndian.PutUint64(data[0:], math.Float64bits(p.Lat))
+	binary.LittleEndian.PutUint64(data[8:], math.Float64bits(p.Lon))
+	binary.LittleEndian.PutUint64(data[16:], uint64(p.Date))
+	return data, nil
+}
+
+func decodePoint(data []byte) (VPTreeItem, error) {
+	if len(data) != 24 {
+		return nil, errors.New("bad point")
+	}
+	return &Point{
+		Lat:  math.Float64frombits(binary.LittleEndian.Uint64(data[0:])),
+		Lon:  math.Float64frombits(binary.LittleEndian.Uint64(data[8:])),
+		Date: int(binary.LittleEndian.Uint64(data[16:]))}, nil
+}
+
+func TestVPTreeWriteRead(t *testing.T) {
+	for _, size := range []int{0, 6} {
+		testVPTreeWriteRead(t, size)
+	}
+}
+
+func testVPTreeWriteRead(t *testing.T, maxChildren int) {
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+	tree.MaxChildren = maxChildren
+
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			points = append(points, &Point{
+				Lat:  float64(i),
+				Lon:  float64(j),
+				Date: i + j})
+		}
+	}
+	tree.SetItems(points)
+	tree.Remove(&Point{Lat: 5, Lon: 5})
+
+	var buf bytes.Buffer
+	n, err := tree.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatal("WriteTo reported", n, "bytes but wrote", buf.Len())
+	}
+
+	loaded, err := ReadVPTree(&buf, decodePoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Distancer = &distancer
+
+	if loaded.ItemCount() != tree.ItemCount() {
+		t.Fatal("Expected", tree.ItemCount(), "items, got", loaded.ItemCount())
+	}
+
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			p := &Point{Lat: float64(i), Lon: float64(j)}
+			want, wantDist := tree.Search(p, 3)
+			got, gotDist := loaded.Search(p, 3)
+			if len(want) != len(got) {
+				t.Fatal("Result count differs", len(want), len(got))
+			}
+			for r := range want {
+				w, g := want[r].(*Point), got[r].(*Point)
+				if w.Lat != g.Lat || w.Lon != g.Lon || wantDist[r] != gotDist[r] {
+					t.Fatal("Loaded tree returned", g, "expected", w)
+				}
+			}
+		}
+	}
+
+	results, distances := loaded.Search(&Point{Lat: 5, Lon: 5}, 1)
+	if len(results) != 1 || distances[0] == 0 {
+		t.Fatal("Removed point returned from loaded tree", results)
+	}
+
+	// Items are bound to their loaded nodes
+	loaded.Remove(results[0])
+	if !results[0].GetNode().IsDead() {
+		t.Fatal("Item not bound to loaded node")
+	}
+}
+
+func TestReadTreeInvalid(t *testing.T) {
+	_, err := ReadVPTree(bytes.NewReader([]byte("nope")), decodePoint)
+	if !errors.Is(err, ErrInvalidFormat) {
+		t.Fatal("Expected ErrInvalidFormat, got", err)
+	}
+
+	var data []byte
+	for _, version := range []uint32{0, treeFormatVersion + 1, 99} {
+		data = binary.LittleEndian.AppendUint32([]byte(treeMagic), version)
+		_, err = ReadVPTree(bytes.NewReader(data), decodePoint)
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Fatal("Expected ErrUnsupportedVersion for version", version, "got", err)
+		}
+	}
+
+	// A header claiming far more items than follow must not allocate them
+	data = binary.LittleEndian.AppendUint32([]byte(treeMagic), treeFormatVersion)
+	data = binary.LittleEndian.AppendUint64(data, math.MaxInt32)
+	_, err = ReadVPTree(bytes.NewReader(data), decodePoint)
+	if !errors.Is(err, ErrInvalidFormat) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal("Expected ErrInvalidFormat or io.ErrUnexpectedEOF, got", err)
+	}
+
+	// Neither must an item or ID length far beyond the end of the stream
+	header := binary.LittleEndian.AppendUint32([]byte(treeMagic), treeFormatVersion)
+	header = binary.LittleEndian.AppendUint64(header, 1)
+	item := binary.LittleEndian.AppendUint32(header, maxEncodedItemSize)
+	id := binary.LittleEndian.AppendUint32(header, 1)
+	id = append(id, 0, 1)
+	id = binary.LittleEndian.AppendUint32(id, maxEncodedItemSize)
+	decode := func(data []byte) ([]byte, error) {
+		return data, nil
+	}
+	for _, data := range [][]byte{item, id} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err = ReadTree(bytes.NewReader(data), decode)
+		runtime.ReadMemStats(&after)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatal("Expected io.ErrUnexpectedEOF, got", err)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Fatal("Reading", len(data), "bytes allocated", allocated)
+		}
+	}
+}
+
+func TestTreeEncodeTruncated(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(5))
+
+	var buf bytes.Buffer
+	_, err := tree.Encode(&buf, func(c city) ([]byte, error) {
+		data := make([]byte, 16)
+		binary.LittleEndian.PutUint64(data[0:], math.Float64bits(c.Lat))
+		binary.LittleEndian.PutUint64(data[8:], math.Float64bits(c.Lon))
+		return data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decode := func(data []byte) (city, error) {
+		return city{
+			Lat: math.Float64frombits(binary.LittleEndian.Uint64(data[0:])),
+			Lon: math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))}, nil
+	}
+
+	_, err = ReadTree(bytes.NewReader(buf.Bytes()[:buf.Len()-3]), decode)
+	if err == nil {
+		t.Fatal("Expected error reading truncated tree")
+	}
+
+	loaded, err := ReadTree(bytes.NewReader(buf.Bytes()), decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Distance = cityDistance
+	results, _ := loaded.Search(city{Lat: 2, Lon: 3}, 1)
+	if len(results) != 1 || results[0].Lat != 2 || results[0].Lon != 3 {
+		t.Fatal("Loaded tree returned", results)
+	}
+}
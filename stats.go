@@ -0,0 +1,96 @@
+package search
+
+import (
+	"sync/atomic"
+)
+
+// SearchStats counts the work done by searches. A brute force scan evaluates
+// the distance to every item, comparing DistanceEvaluations per search against
+// ItemCount shows how much the tree saves. A growing share of DeadSkipped
+// means removed items slow the searches down and it is time to Rebuild.
+type SearchStats struct {
+	// Searches is the number of searches counted
+	Searches int
+	// DistanceEvaluations is the number of distances calculated
+	DistanceEvaluations int
+	// NodesVisited is the number of tree nodes entered, a leaf bucket counts
+	// as a single node
+	NodesVisited int
+	// NodesPruned is the number of subtrees and leaf buckets left out
+	// because their bounds show they hold no result
+	NodesPruned int
+	// DeadSkipped is the number of nodes marked for removal passed over
+	DeadSkipped int
+}
+
+// searchCounters holds the running totals of a tree's searches
+type searchCounters struct {
+	searches, evals, visited, pruned, dead atomic.Int64
+}
+
+// stats returns the work done by the search so far
+func (s *searcher[T]) stats() SearchStats {
+	return SearchStats{
+		Searches:            1,
+		DistanceEvaluations: s.evals,
+		NodesVisited:        s.visited,
+		NodesPruned:         s.pruned,
+		DeadSkipped:         s.dead,
+	}
+}
+
+// collecting returns if searches are added to the counters
+func (t *Tree[T]) collecting() bool {
+	if t.collectStats != nil {
+		return t.collectStats()
+	}
+	return t.CollectStats
+}
+
+// record adds the work of a finished search to the counters
+func (t *Tree[T]) record(s *searcher[T]) {
+	if !t.collecting() {
+		return
+	}
+	c := &t.counters
+	c.searches.Add(1)
+	c.evals.Add(int64(s.evals))
+	c.visited.Add(int64(s.visited))
+	c.pruned.Add(int64(s.pruned))
+	c.dead.Add(int64(s.dead))
+}
+
+// SearchStats returns the work done by all searches since CollectStats was
+// set or the counters were last reset. Search, SearchInRange, SearchRadius,
+// CountInRadius, SearchContext and SearchBatch are counted, each target of a
+// batch as a single search.
+func (t *Tree[T]) SearchStats() SearchStats {
+	c := &t.counters
+	return SearchStats{
+		Searches:            int(c.searches.Load()),
+		DistanceEvaluations: int(c.evals.Load()),
+		NodesVisited:        int(c.visited.Load()),
+		NodesPruned:         int(c.pruned.Load()),
+		DeadSkipped:         int(c.dead.Load()),
+	}
+}
+
+// ResetSearchStats sets the counters returned by SearchStats back to zero
+func (t *Tree[T]) ResetSearchStats() {
+	c := &t.counters
+	c.searches.Store(0)
+	c.evals.Store(0)
+	c.visited.Store(0)
+	c.pruned.Store(0)
+	c.dead.Store(0)
+}
+
+// SearchStats returns the work done by all searches, see Tree.SearchStats
+func (v *VPTree) SearchStats() SearchStats {
+	return v.core().SearchStats()
+}
+
+// ResetSearchStats sets the counters returned by SearchStats back to zero
+func (v *VPTree) ResetSearchStats() {
+	v.core().ResetSearchStats()
+}
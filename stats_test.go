@@ -0,0 +1,94 @@
+package search
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSearchStatsCountsWork(t *testing.T) {
+	var distancer countingDistancer
+	tree := searchContextTree(&distancer)
+	n := tree.ItemCount()
+
+	var stats SearchStats
+	distancer.calls = 0
+	_, _, err := tree.SearchContext(context.Background(), &Point{Lat: 12.3, Lon: 4.5}, 5,
+		SearchOptions[VPTreeItem]{Stats: &stats})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Searches != 1 || stats.DistanceEvaluations != distancer.calls {
+		t.Fatal("Counted", stats, "for", distancer.calls, "distance calls")
+	}
+	// A brute force scan evaluates every item
+	if stats.DistanceEvaluations >= n/2 || stats.NodesPruned == 0 {
+		t.Fatal("Search did no better than brute force", stats)
+	}
+	if stats.NodesVisited == 0 || stats.DeadSkipped != 0 {
+		t.Fatal("Counted", stats)
+	}
+
+	removed := 0
+	for _, item := range tree.Items() {
+		p := item.(*Point)
+		if p.Lat < 10 {
+			tree.Remove(item)
+			removed++
+		}
+	}
+	_, _, err = tree.SearchContext(context.Background(), &Point{Lat: 1, Lon: 1}, n,
+		SearchOptions[VPTreeItem]{Stats: &stats})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every live item is a result, so nothing can be pruned
+	if stats.DeadSkipped != removed || stats.DistanceEvaluations != n-removed || stats.NodesPruned != 0 {
+		t.Fatal("Counted", stats, "with", removed, "of", n, "removed")
+	}
+}
+
+func TestSearchStatsCollected(t *testing.T) {
+	var distancer countingDistancer
+	tree := searchContextTree(&distancer)
+	target := &Point{Lat: 3.3, Lon: 7.1}
+
+	tree.Search(target, 3)
+	if stats := tree.SearchStats(); stats != (SearchStats{}) {
+		t.Fatal("Counted", stats, "without CollectStats")
+	}
+
+	tree.CollectStats = true
+	distancer.calls = 0
+	tree.Search(target, 3)
+	tree.SearchRadius(target, 200)
+	tree.CountInRadius(target, 200)
+	tree.SearchBatch([]VPTreeItem{target, target}, 3, 1)
+
+	stats := tree.SearchStats()
+	if stats.Searches != 5 || stats.DistanceEvaluations != distancer.calls {
+		t.Fatal("Counted", stats, "for", distancer.calls, "distance calls")
+	}
+	if stats.NodesVisited == 0 || stats.NodesPruned == 0 {
+		t.Fatal("Counted", stats)
+	}
+
+	tree.ResetSearchStats()
+	if stats := tree.SearchStats(); stats != (SearchStats{}) {
+		t.Fatal("Counted", stats, "after reset")
+	}
+}
+
+func TestTreeSearchStatsParallel(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance, MaxChildren: 4, CollectStats: true}
+	cities := gridCities(20)
+	tree.SetItems(cities)
+
+	tree.SearchBatch(cities, 4, 4)
+	stats := tree.SearchStats()
+	if stats.Searches != len(cities) {
+		t.Fatal("Expected", len(cities), "searches, got", stats.Searches)
+	}
+	if stats.DistanceEvaluations >= len(cities)*len(cities)/2 {
+		t.Fatal("Batch did no better than brute force", stats)
+	}
+}
@@ -0,0 +1,87 @@
+package search
+
+import (
+	"sync"
+)
+
+// StringIndex is a typo tolerant index of strings, for example product names
+// or addresses, built on a VPTree. The zero value is an empty index comparing
+// strings by Levenshtein distance.
+type StringIndex struct {
+	// Transpositions counts swapping two adjacent characters as a single edit
+	// by comparing with Damerau-Levenshtein distance. It must be set before
+	// the index is first used.
+	Transpositions bool
+	// MaxChildren is the largest number of strings stored in a leaf bucket,
+	// see VPTree. It must be set before the index is first used.
+	MaxChildren int
+	tree        VPTree
+	once        sync.Once
+}
+
+// index returns the tree with its distancer set up
+func (s *StringIndex) index() *VPTree {
+	s.once.Do(func() {
+		if s.Transpositions {
+			s.tree.Distancer = &DamerauLevenshteinDistancer{}
+		} else {
+			s.tree.Distancer = &LevenshteinDistancer{}
+		}
+		s.tree.MaxChildren = s.MaxChildren
+	})
+	return &s.tree
+}
+
+// SetStrings will (re)build the index for the values
+func (s *StringIndex) SetStrings(values []string) {
+	items := make([]VPTreeItem, len(values))
+	for i, v := range values {
+		items[i] = NewText(v)
+	}
+	s.index().SetItems(items)
+}
+
+// Insert adds the value to the index
+func (s *StringIndex) Insert(value string) {
+	s.index().Insert(NewText(value))
+}
+
+// Remove marks one copy of the value for removal. It returns false if the
+// value is not in the index.
+func (s *StringIndex) Remove(value string) bool {
+	results, distances := s.index().Search(NewText(value), 1)
+	if len(results) == 0 || distances[0] != 0 {
+		return false
+	}
+	s.index().Remove(results[0])
+	return true
+}
+
+// ItemCount returns the number of strings in the index
+func (s *StringIndex) ItemCount() int {
+	return s.index().ItemCount()
+}
+
+// Fuzzy returns up to k values at most maxEdits edits away from the query
+// sorted by the number of edits ascending, along with the number of edits.
+// When k is 0 or less every value within maxEdits is returned.
+func (s *StringIndex) Fuzzy(query string, maxEdits, k int) ([]string, []int) {
+	target := NewText(query)
+	maxDist := float64(maxEdits) + 0.5
+
+	var items []VPTreeItem
+	var distances []float64
+	if k > 0 {
+		items, distances = s.index().SearchInRange(target, k, maxDist)
+	} else {
+		items, distances = s.index().SearchRadius(target, maxDist)
+	}
+
+	values := make([]string, len(items))
+	edits := make([]int, len(items))
+	for i, item := range items {
+		values[i] = item.(*Text).Value
+		edits[i] = int(distances[i])
+	}
+	return values, edits
+}
@@ -0,0 +1,762 @@
+package search
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Tree is a vp-tree index over values of any type. Unlike VPTree the indexed
+// values do not need to carry any tree bookkeeping, the distance between two
+// values is provided by the Distance function.
+//
+// A Tree is safe for concurrent use once its fields are set. Searches hold a
+// read lock so any number of them run in parallel and never observe a
+// partially inserted node. SetItems, Insert, Remove and Rebuild hold the write
+// lock, they are serialized and wait for running searches to finish.
+type Tree[T any] struct {
+	// Distance returns the distance between two items satisfying the triangle
+	// inequality
+	Distance func(a, b T) float64
+	// BoundedDistance optionally speeds up searches with a distance that may
+	// stop early. It returns the same as Distance when that is at most limit,
+	// otherwise any value greater than limit.
+	BoundedDistance func(a, b T, limit float64) float64
+	// MaxChildren is the largest number of items stored in a leaf bucket.
+	// Subtrees this small are kept as a flat list and scanned linearly. Values
+	// below 2 disable buckets.
+	MaxChildren int
+	// CollectStats adds the work of every search to the counters returned by
+	// SearchStats. It must be set before the tree is first searched.
+	CollectStats bool
+	root         *VPTreeNode
+	items        []T
+	nodes        []*VPTreeNode
+	_deadIdx     []int
+
+	// Optional caller supplied IDs, itemIDs is parallel to items and nil
+	// until the first ID is used
+	itemIDs []string
+	byID    map[string]int
+	mutex   sync.RWMutex
+
+	// generation changes whenever the whole index is replaced, splits
+	// whenever a bucket is split into a subtree by Insert
+	generation  uint64
+	splits      uint64
+	rebuildDone chan struct{}
+
+	// Rebuild policy state, reset by every build
+	policy      RebuildPolicy
+	inserts     int
+	insertDepth int
+
+	// Optional hooks used by the VPTree compatibility wrapper
+	skip         func(item, target T) bool
+	affinity     func(dist float64, item, target T) float64
+	bind         func(item T, node *VPTreeNode)
+	lookup       func(item T) *VPTreeNode
+	bucketSize   func() int
+	scoreBounds  func() ScoreBounds
+	collectStats func() bool
+
+	// Totals of the searches counted while CollectStats is set
+	counters searchCounters
+}
+
+// SetItems will (re)build the index for the slice of items. The tree keeps
+// the slice, it must not be modified afterwards.
+func (t *Tree[T]) SetItems(items []T) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.setItems(items)
+}
+
+func (t *Tree[T]) setItems(items []T) {
+	t.setItemsWithIDs(items, nil)
+}
+
+// setItemsWithIDs builds the index, ids is either nil or parallel to items
+func (t *Tree[T]) setItemsWithIDs(items []T, ids []string) {
+	t.generation++
+	t.inserts, t.insertDepth = 0, 0
+	t.itemIDs, t.byID = nil, nil
+	if ids != nil {
+		t.itemIDs = ids
+		t.byID = make(map[string]int, len(ids))
+		for i, id := range ids {
+			if id != "" {
+				t.byID[id] = i
+			}
+		}
+	}
+	t.items = items
+	t._deadIdx = make([]int, 0)
+	t.nodes = make([]*VPTreeNode, len(items))
+	for i := 0; i < len(t.nodes); i++ {
+		var n VPTreeNode
+		n.index = i
+		t.nodes[i] = &n
+		if t.bind != nil {
+			t.bind(items[i], &n)
+		}
+	}
+	nodes := make([]*VPTreeNode, len(t.nodes))
+	copy(nodes, t.nodes)
+	t.root = t.buildFromPoints(nodes)
+}
+
+// leafSize returns the bucket capacity, 0 when buckets are disabled
+func (t *Tree[T]) leafSize() int {
+	size := t.MaxChildren
+	if t.bucketSize != nil {
+		size = t.bucketSize()
+	}
+	if size < 2 {
+		return 0
+	}
+	return size
+}
+
+// ItemCount returns the number of items in the tree
+func (t *Tree[T]) ItemCount() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.items)
+}
+
+// Items returns the indexed items including those marked for removal. The
+// returned slice must not be modified.
+func (t *Tree[T]) Items() []T {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.items
+}
+
+// Search returns the nearest k items to the target. The items are sorted with
+// by distance ascending. The second parameter is the repective distances to the
+// target
+func (t *Tree[T]) Search(target T, k int) ([]T, []float64) {
+	return t.SearchInRange(target, k, math.MaxFloat64)
+}
+
+// SearchInRange returns the nearest k items to the target sorted by distance
+// ascending with no result being more that maxDistance away from the target.
+func (t *Tree[T]) SearchInRange(target T, k int, maxDist float64) ([]T, []float64) {
+	if k <= 0 {
+		return []T{}, []float64{}
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	s := t.newSearcher(target, k, maxDist)
+	s.useAffinity()
+	s.search(t.root)
+	t.record(&s)
+
+	return s.results()
+}
+
+// SearchRadius returns every item closer than maxDist to the target sorted by
+// distance ascending. Affinity is not applied, the second parameter is the raw
+// distances to the target.
+func (t *Tree[T]) SearchRadius(target T, maxDist float64) ([]T, []float64) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	s := t.newSearcher(target, 0, maxDist)
+	s.search(t.root)
+	t.record(&s)
+
+	return s.results()
+}
+
+// CountInRadius returns the number of items closer than maxDist to the target
+// without collecting them
+func (t *Tree[T]) CountInRadius(target T, maxDist float64) int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	s := t.newSearcher(target, 0, maxDist)
+	s.countOnly = true
+	s.search(t.root)
+	t.record(&s)
+
+	return s.count
+}
+
+// searcher holds the state of a single search through the tree
+type searcher[T any] struct {
+	tree   *Tree[T]
+	target T
+	// k is the number of results to keep, 0 keeps every item within maxDist
+	k             int
+	pq            PriorityQueue
+	tau           float64
+	maxDist       float64
+	applyAffinity bool
+	countOnly     bool
+	count         int
+	// limit stops a counting search once count reaches it, 0 counts all
+	limit int
+	// spare holds heap items for reuse by later pushes
+	spare []*vpHeapItem
+	// self is left out of the results when searching for an indexed item
+	self *VPTreeNode
+	// Per search replacements for the skip and affinity hooks
+	filter  func(item T) bool
+	rescore func(item T, dist float64) float64
+	// bounds declares how far scores may fall below the distances
+	bounds ScoreBounds
+
+	// Limits for SearchContext
+	ctx    context.Context
+	done   <-chan struct{}
+	budget int
+	evals  int
+	err    error
+
+	// Approximate search settings
+	epsilon    float64
+	maxVisited int
+	visited    int
+
+	// Subtrees pruned by their bounds and dead nodes passed over, see
+	// SearchStats
+	pruned int
+	dead   int
+}
+
+func (t *Tree[T]) newSearcher(target T, k int, maxDist float64) searcher[T] {
+	return searcher[T]{
+		tree:    t,
+		target:  target,
+		k:       k,
+		tau:     maxDist,
+		maxDist: maxDist,
+	}
+}
+
+// useAffinity ranks the results by the affinity hook within its declared
+// bounds
+func (s *searcher[T]) useAffinity() {
+	s.applyAffinity = true
+	if s.tree.scoreBounds != nil {
+		s.bounds = s.tree.scoreBounds()
+	}
+}
+
+// results drains the queue into items and distances sorted ascending
+func (s *searcher[T]) results() ([]T, []float64) {
+	pq := &s.pq
+	results := make([]T, pq.Len())
+	distances := make([]float64, pq.Len())
+
+	for i := pq.Len() - 1; i >= 0; i-- {
+		item := heap.Pop(pq).(*vpHeapItem)
+		results[i] = s.tree.items[item.index]
+		distances[i] = item.Priority()
+		s.spare = append(s.spare, item)
+	}
+
+	return results, distances
+}
+
+// skipped returns if the item should not be considered for the results
+func (s *searcher[T]) skipped(node *VPTreeNode) bool {
+	t := s.tree
+	if node._dead {
+		s.dead++
+		return true
+	}
+	if node == s.self {
+		return true
+	}
+	if s.filter != nil {
+		return !s.filter(t.items[node.index])
+	}
+	return t.skip != nil && t.skip(t.items[node.index], s.target)
+}
+
+func (s *searcher[T]) search(node *VPTreeNode) {
+	if node == nil || s.halted() {
+		return
+	}
+	s.visited++
+
+	if node.isLeaf {
+		s.searchLeaf(node)
+		return
+	}
+
+	if s.skipped(node) {
+		s.search(node.left)
+		s.search(node.right)
+		return
+	}
+
+	tt := s.radius()
+	dist := s.offer(node, nil)
+
+	if node.left == nil && node.right == nil {
+		return
+	}
+
+	if dist < node.threshold {
+		s.searchChild(node.left, node.m-tt <= dist)
+		s.searchChild(node.right, node.threshold-tt < dist && dist < node.M+tt)
+	} else {
+		s.searchChild(node.right, node.m-tt < dist)
+		s.searchChild(node.left, node.m-tt < dist && dist < node.threshold+tt)
+	}
+}
+
+// searchChild searches the subtree when its bounds may hold a result,
+// otherwise it is counted as pruned
+func (s *searcher[T]) searchChild(node *VPTreeNode, overlaps bool) {
+	if node == nil {
+		return
+	}
+	if !overlaps {
+		s.pruned++
+		return
+	}
+	s.search(node)
+}
+
+// searchLeaf scans the vantage point and every child of a leaf bucket. The
+// children are skipped entirely when the leaf bounds show none can be closer
+// than tau.
+func (s *searcher[T]) searchLeaf(node *VPTreeNode) {
+	if !s.skipped(node) {
+		tt := s.radius()
+		dist := s.offer(node, nil)
+		if dist-node.M >= tt || node.m-dist >= tt {
+			if len(node.children) > 0 {
+				s.pruned++
+			}
+			return
+		}
+	}
+
+	for _, idx := range node.children {
+		child := s.tree.nodes[idx]
+		if s.skipped(child) {
+			continue
+		}
+		if s.halted() {
+			return
+		}
+		s.offer(child, node)
+	}
+}
+
+// offer calculates the distance from the node's item to the target and adds it
+// to the results when it is close enough. It returns the raw distance.
+func (s *searcher[T]) offer(node, parent *VPTreeNode) float64 {
+	t := s.tree
+	s.evals++
+	var dist float64
+	if t.BoundedDistance != nil {
+		dist = t.BoundedDistance(t.items[node.index], s.target, s.limitFor(node, parent))
+	} else {
+		dist = t.Distance(t.items[node.index], s.target)
+	}
+	var priority float64
+	switch {
+	case s.rescore != nil && dist < s.maxDist:
+		priority = s.rescore(t.items[node.index], dist)
+	case s.applyAffinity && t.affinity != nil && dist < s.maxDist:
+		priority = t.affinity(dist, t.items[node.index], s.target)
+	default:
+		priority = dist
+	}
+
+	// This Vantage-point is close enough
+	if priority < s.tau {
+		if s.countOnly {
+			s.count++
+			return dist
+		}
+
+		pq := &s.pq
+		if s.k > 0 && pq.Len() == s.k {
+			s.spare = append(s.spare, heap.Pop(pq).(*vpHeapItem))
+		}
+
+		var item *vpHeapItem
+		if n := len(s.spare); n > 0 {
+			item = s.spare[n-1]
+			s.spare = s.spare[:n-1]
+		} else {
+			item = new(vpHeapItem)
+		}
+		*item = vpHeapItem{
+			index:  node.index,
+			dist:   priority,
+			node:   node,
+			parent: parent}
+		heap.Push(pq, item)
+
+		if s.k > 0 && pq.Len() == s.k {
+			s.tau = (*pq)[0].Priority()
+		}
+	}
+
+	return dist
+}
+
+// limitFor returns the distance beyond which the exact distance to the node's
+// item makes no difference to the search. Such an item can not score below
+// tau and, when it is a vantage point, both its subtrees are pruned.
+func (s *searcher[T]) limitFor(node, parent *VPTreeNode) float64 {
+	limit := s.bounds.radius(s.tau)
+	if parent == nil {
+		limit = math.Max(limit, math.Max(node.M, node.threshold)+s.radius())
+	}
+	return limit
+}
+
+func (t *Tree[T]) medianOf3(list []*VPTreeNode, a int, b int, c int) int {
+	A, B, C := list[a], list[b], list[c]
+	if A.dist < B.dist {
+		if B.dist < C.dist {
+			return b
+		}
+		if A.dist < C.dist {
+			return c
+		}
+		return a
+	}
+	if A.dist < C.dist {
+		return a
+	}
+	if B.dist < C.dist {
+		return c
+	}
+	return b
+}
+
+func (t *Tree[T]) partition(list []*VPTreeNode, left, right, pivotIndex int) int {
+	pivotValue := list[pivotIndex]
+	list[pivotIndex], list[right] = list[right], list[pivotIndex]
+	storeIndex := left
+	for i := left; i < right; i++ {
+		if list[i].dist < pivotValue.dist {
+			list[storeIndex], list[i] = list[i], list[storeIndex]
+			storeIndex++
+		}
+	}
+	list[right], list[storeIndex] = list[storeIndex], list[right]
+	return storeIndex
+}
+
+func (t *Tree[T]) nthElement(list []*VPTreeNode, left, nth, right int) *VPTreeNode {
+	var pivotIndex, pivotNewIndex, pivotDist int
+	for {
+		pivotIndex = t.medianOf3(list, left, right, (left+right)>>1)
+		pivotNewIndex = t.partition(list, left, right, pivotIndex)
+		pivotDist = pivotNewIndex - left + 1
+		if pivotDist == nth {
+			return list[pivotNewIndex]
+		} else if nth < pivotDist {
+			right = pivotNewIndex - 1
+		} else {
+			nth -= pivotDist
+			left = pivotNewIndex + 1
+		}
+	}
+}
+
+func (t *Tree[T]) buildFromPoints(nodes []*VPTreeNode) *VPTreeNode {
+	listLength := len(nodes)
+	if listLength == 0 {
+		return nil
+	}
+
+	vpIndex := rand.Intn(listLength)
+	node := nodes[vpIndex]
+	nodes = append(nodes[0:vpIndex], nodes[vpIndex+1:]...)
+	node.left, node.right = nil, nil
+	node.children, node.isLeaf = nil, false
+	node.threshold, node.m, node.M = 0, 0, 0
+	listLength--
+
+	vp := t.items[node.index]
+
+	// Is this a leaf node
+	if size := t.leafSize(); size > 0 && listLength < size {
+		node.isLeaf = true
+		if listLength == 0 {
+			return node
+		}
+		node.children = make([]int, listLength)
+		node.m = math.MaxFloat64
+		for i, child := range nodes {
+			node.children[i] = child.index
+			t.extendBounds(node, t.Distance(vp, t.items[child.index]))
+		}
+		node.threshold = node.M
+		return node
+	}
+
+	if listLength == 0 {
+		return node
+	}
+
+	// Ensure Distance calculations are only done once per sort
+	S := t.items
+	var wg sync.WaitGroup
+	distances := make([]float64, listLength)
+	batchSize := int(math.Ceil(float64(listLength) / float64(runtime.NumCPU())))
+	for i := 0; i < listLength; i += batchSize {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			end := idx + batchSize
+			if end > listLength {
+				end = listLength
+			}
+			for j := idx; j < end; j++ {
+				item := nodes[j]
+				dist := t.Distance(vp, S[item.index])
+				item.dist = dist
+				distances[j] = dist
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	sort.Float64s(distances)
+
+	node.m = distances[0]
+	node.M = distances[listLength-1]
+
+	medianIndex := listLength >> 1
+	median := t.nthElement(nodes, 0, medianIndex+1, listLength-1)
+
+	leftItems := nodes[0:medianIndex]
+	rightItems := nodes[medianIndex:]
+
+	node.threshold = median.dist
+	node.left = t.buildFromPoints(leftItems)
+	node.right = t.buildFromPoints(rightItems)
+
+	return node
+}
+
+// extendBounds widens the leaf bounds to include a child at dist
+func (t *Tree[T]) extendBounds(node *VPTreeNode, dist float64) {
+	if dist < node.m {
+		node.m = dist
+	}
+	if dist > node.M {
+		node.M = dist
+	}
+}
+
+// nearest returns the node of the item closest to item ignoring affinity, or
+// nil if the tree has no live items
+func (t *Tree[T]) nearest(item T) *VPTreeNode {
+	s := t.newSearcher(item, 1, math.MaxFloat64)
+	s.search(t.root)
+
+	if s.pq.Len() < 1 {
+		return nil
+	}
+
+	return t.nodes[s.pq[0].(*vpHeapItem).index]
+}
+
+// Insert adds a new item to the index. The item is placed below the node it
+// reaches descending from the root without rebalancing the tree.
+func (t *Tree[T]) Insert(item T) {
+	t.mutex.Lock()
+	t.insert(item, "")
+	event := t.checkPolicy()
+	t.mutex.Unlock()
+
+	t.applyPolicy(event)
+}
+
+// insert adds item with an optional id, the id must not be in use
+func (t *Tree[T]) insert(item T, id string) {
+	if (len(t.items) - len(t._deadIdx)) <= 0 {
+		var ids []string
+		if id != "" {
+			ids = []string{id}
+		}
+		t.setItemsWithIDs([]T{item}, ids)
+		return
+	}
+
+	t.inserts++
+	depth := 1
+	defer func() {
+		if depth > t.insertDepth {
+			t.insertDepth = depth
+		}
+	}()
+
+	var node VPTreeNode
+	node.index = len(t.items)
+	t.items = append(t.items, item)
+	t.nodes = append(t.nodes, &node)
+	if id != "" && t.itemIDs == nil {
+		t.itemIDs = make([]string, node.index, cap(t.items))
+		t.byID = make(map[string]int)
+	}
+	if t.itemIDs != nil {
+		t.itemIDs = append(t.itemIDs, id)
+		if id != "" {
+			t.byID[id] = node.index
+		}
+	}
+	if t.bind != nil {
+		t.bind(item, &node)
+	}
+
+	size := t.leafSize()
+	if size > 0 {
+		node.isLeaf = true
+	}
+
+	link := &t.root
+	match := t.root
+	for {
+		dist := t.Distance(t.items[match.index], item)
+		if match.isLeaf {
+			if len(match.children)+1 < size {
+				if len(match.children) == 0 {
+					match.m, match.M = dist, dist
+				}
+				t.extendBounds(match, dist)
+				match.threshold = match.M
+				match.children = append(match.children, node.index)
+				node.isLeaf = false
+				return
+			}
+			// Split the full bucket into a subtree
+			bucket := make([]*VPTreeNode, 0, len(match.children)+2)
+			bucket = append(bucket, match, &node)
+			for _, idx := range match.children {
+				bucket = append(bucket, t.nodes[idx])
+			}
+			*link = t.buildFromPoints(bucket)
+			t.splits++
+			return
+		}
+		if dist <= match.threshold {
+			if dist < match.m {
+				match.m = dist
+			}
+			if match.left == nil {
+				match.m = dist
+				match.left = &node
+				depth++
+				return
+			}
+			link = &match.left
+			match = match.left
+			depth++
+		} else {
+			if dist > match.M {
+				match.M = dist
+			}
+			if match.right == nil {
+				match.M = dist
+				match.right = &node
+				depth++
+				return
+			}
+			link = &match.right
+			match = match.right
+			depth++
+		}
+	}
+}
+
+// Remove marks the item nearest to the given one as removed so it is no
+// longer included in search results. The item will be removed from the index
+// when the index rebuilds
+func (t *Tree[T]) Remove(item T) {
+	t.mutex.Lock()
+	t.remove(item)
+	event := t.checkPolicy()
+	t.mutex.Unlock()
+
+	t.applyPolicy(event)
+}
+
+func (t *Tree[T]) remove(item T) {
+	if t.root == nil {
+		return
+	}
+
+	if t.lookup != nil {
+		if node := t.lookup(item); t.owns(node) {
+			t.removeNode(node)
+			return
+		}
+	}
+
+	if match := t.nearest(item); match != nil {
+		t.removeNode(match)
+	}
+}
+
+// owns returns if node is the current node of one of the tree's items
+func (t *Tree[T]) owns(node *VPTreeNode) bool {
+	return node != nil && node.index < len(t.nodes) && t.nodes[node.index] == node
+}
+
+// removeNode marks a single node for deletion
+func (t *Tree[T]) removeNode(node *VPTreeNode) {
+	if node._dead {
+		return
+	}
+	node._dead = true
+	t._deadIdx = append(t._deadIdx, node.index)
+	if t.itemIDs != nil {
+		if id := t.itemIDs[node.index]; id != "" && t.byID[id] == node.index {
+			delete(t.byID, id)
+		}
+	}
+}
+
+// Rebuild will trigger a rebuild on the index over the same items. All items
+// marked for removal will be removed from the item list at this stage
+func (t *Tree[T]) Rebuild() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.rebuild()
+}
+
+// rebuild builds the index over the live items, keeping their IDs
+func (t *Tree[T]) rebuild() {
+	t.setItemsWithIDs(t.liveItems(len(t.items)))
+}
+
+// liveItems returns new slices of the first n items not marked for removal
+// and their IDs, the IDs are nil when none are used
+func (t *Tree[T]) liveItems(n int) ([]T, []string) {
+	live := make([]T, 0, n)
+	var ids []string
+	if t.itemIDs != nil {
+		ids = make([]string, 0, n)
+	}
+	for i := 0; i < n; i++ {
+		if !t.nodes[i]._dead {
+			live = append(live, t.items[i])
+			if ids != nil {
+				ids = append(ids, t.itemIDs[i])
+			}
+		}
+	}
+	return live, ids
+}
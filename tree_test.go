@@ -0,0 +1,134 @@
+package search
+
+import (
+	"math"
+	"testing"
+)
+
+type city struct {
+	Name     string
+	Lat, Lon float64
+}
+
+func cityDistance(a, b city) float64 {
+	return HaversineEarth(a.Lat, a.Lon, b.Lat, b.Lon)
+}
+
+func gridCities(n int) []city {
+	cities := make([]city, 0, n*n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			cities = append(cities, city{
+				Lat: float64(i),
+				Lon: float64(j)})
+		}
+	}
+	return cities
+}
+
+func TestTreeAllPointsFindable(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(10))
+
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			target := city{Lat: float64(i), Lon: float64(j)}
+			results, distances := tree.Search(target, 1)
+			if len(results) != 1 || len(distances) != 1 {
+				t.Fatal("Expected 1 result, got", len(results), len(distances))
+			}
+			if results[0] != target {
+				t.Log("Returned Incorrect Result", results[0], "not", target)
+				t.Fail()
+			}
+			if distances[0] != 0 {
+				t.Log("Distance not idempotent, expected 0 not", distances[0])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestTreeSearchSortedByDistance(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(10))
+
+	_, distances := tree.Search(city{Lat: 4.5, Lon: 4.5}, 10)
+	if len(distances) != 10 {
+		t.Fatal("Expected 10 results, got", len(distances))
+	}
+	for i := 1; i < len(distances); i++ {
+		if distances[i] < distances[i-1] {
+			t.Fatal("Distances not ascending", distances)
+		}
+	}
+}
+
+func TestTreeInsertRemoveRebuild(t *testing.T) {
+	tree := Tree[city]{Distance: cityDistance}
+	tree.SetItems(gridCities(10))
+
+	inserted := city{Name: "inserted", Lat: 5.5, Lon: 5.5}
+	tree.Insert(inserted)
+	results, _ := tree.Search(inserted, 1)
+	if len(results) != 1 || results[0] != inserted {
+		t.Fatal("Inserted item not found", results)
+	}
+
+	tree.Remove(city{Lat: 5, Lon: 5})
+	results, distances := tree.Search(city{Lat: 5, Lon: 5}, 1)
+	if len(results) != 1 || distances[0] == 0 {
+		t.Fatal("Removed item returned", results)
+	}
+
+	tree.Rebuild()
+	if tree.ItemCount() != 100 {
+		t.Fatal("Expected 100 items after rebuild, got", tree.ItemCount())
+	}
+	results, distances = tree.Search(inserted, 1)
+	if len(results) != 1 || results[0] != inserted || math.Abs(distances[0]) > 0 {
+		t.Fatal("Inserted item not found after rebuild", results)
+	}
+}
+
+func TestTreeSearchRadius(t *testing.T) {
+	for _, size := range []int{0, 8} {
+		tree := Tree[city]{Distance: cityDistance, MaxChildren: size}
+		cities := gridCities(20)
+		tree.SetItems(cities)
+		tree.Remove(city{Lat: 10, Lon: 10})
+
+		target := city{Lat: 10.2, Lon: 9.7}
+		radius := 250000.0
+
+		expected := 0
+		for _, c := range cities {
+			if c.Lat == 10 && c.Lon == 10 {
+				continue
+			}
+			if cityDistance(c, target) < radius {
+				expected++
+			}
+		}
+
+		results, distances := tree.SearchRadius(target, radius)
+		if len(results) != expected || len(distances) != expected {
+			t.Fatal("Expected", expected, "results, got", len(results))
+		}
+		for i, r := range results {
+			if r.Lat == 10 && r.Lon == 10 {
+				t.Fatal("Removed item returned")
+			}
+			if distances[i] >= radius || distances[i] != cityDistance(r, target) {
+				t.Fatal("Incorrect distance", distances[i], "for", r)
+			}
+			if i > 0 && distances[i] < distances[i-1] {
+				t.Fatal("Distances not ascending", distances)
+			}
+		}
+
+		if count := tree.CountInRadius(target, radius); count != expected {
+			t.Fatal("Expected count", expected, "got", count)
+		}
+	}
+}
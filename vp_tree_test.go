@@ -1,8 +1,11 @@
 package search
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"math/rand"
+	"sync"
 	"testing"
 )
 
@@ -176,35 +179,39 @@ func TestVPTreeParallelSearch(t *testing.T) {
 
 	tree.SetItems(points)
 
+	var wg sync.WaitGroup
 	for i := 1; i < 100; i++ {
 		for j := 0; j < 100; j++ {
+			wg.Add(1)
 			go func(lat, lon float64, date int, dist float64) {
+				defer wg.Done()
 				point := Point{
 					Lat:  lat,
 					Lon:  lon,
 					Date: date}
 				results, distances := tree.Search(&point, 1)
 				if len(results) != 1 {
-					t.Log("Results should have 1 item, not", len(results))
-					t.FailNow()
+					t.Error("Results should have 1 item, not", len(results))
+					return
 				}
 				if len(distances) != 1 {
-					t.Log("Distances should have 1 item, not", len(distances))
-					t.FailNow()
+					t.Error("Distances should have 1 item, not", len(distances))
+					return
 				}
 				res := results[0].(*Point)
 				dist = distances[0]
 				if res.Lat != lat || res.Lon != lon {
-					t.Log("Returned Incorrect Result", res, "not", point)
-					t.FailNow()
+					t.Error("Returned Incorrect Result", res, "not", point)
+					return
 				}
 				if dist != float64(0) {
-					t.Log("Distance not idempotent, expected 0 not", dist)
-					t.FailNow()
+					t.Error("Distance not idempotent, expected 0 not", dist)
+					return
 				}
 			}(float64(i), float64(j), i+j, 0)
 		}
 	}
+	wg.Wait()
 
 }
 
@@ -681,3 +688,210 @@ func BenchmarkTreeSearchAfterInsert(b *testing.B) {
 	}
 
 }
+
+func TestVPTreeLeafBuckets(t *testing.T) {
+
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+	tree.MaxChildren = 8
+
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			point := Point{
+				Lat:  float64(i),
+				Lon:  float64(j),
+				Date: i + j}
+			points = append(points, &point)
+		}
+	}
+
+	tree.SetItems(points)
+
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			point := Point{
+				Lat: float64(i) + 0.25,
+				Lon: float64(j) + 0.25}
+			results, distances := tree.Search(&point, 1)
+			if len(results) != 1 || len(distances) != 1 {
+				t.Fatal("Results should have 1 item, not", len(results))
+			}
+			res := results[0].(*Point)
+			if res.Lat != float64(i) || res.Lon != float64(j) {
+				t.Fatal("Returned Incorrect Result", res, "not", point)
+			}
+		}
+	}
+
+	// Fill buckets past capacity so they split
+	inserted := make([]*Point, 0)
+	for i := 0; i < 500; i++ {
+		p := &Point{
+			Lat:  rand.Float64() * 20,
+			Lon:  rand.Float64() * 20,
+			Date: i}
+		tree.Insert(p)
+		inserted = append(inserted, p)
+	}
+
+	for _, p := range inserted {
+		results, distances := tree.Search(p, 1)
+		if len(results) != 1 || distances[0] != 0 {
+			t.Fatal("Inserted point not found", p)
+		}
+	}
+
+	removed := inserted[10]
+	tree.Remove(removed)
+	results, distances := tree.Search(removed, 1)
+	if len(results) != 1 || results[0] == VPTreeItem(removed) || distances[0] == 0 {
+		t.Fatal("Removed point returned", results[0])
+	}
+
+	tree.Rebuild()
+	if tree.ItemCount() != 899 {
+		t.Fatal("Expected 899 items after rebuild, not", tree.ItemCount())
+	}
+	for _, p := range inserted[11:] {
+		results, distances := tree.Search(p, 1)
+		if len(results) != 1 || distances[0] != 0 {
+			t.Fatal("Point not found after rebuild", p)
+		}
+	}
+
+}
+
+func vpTreeDepth(node *VPTreeNode) int {
+	if node == nil {
+		return 0
+	}
+	left, right := vpTreeDepth(node.left), vpTreeDepth(node.right)
+	if left > right {
+		return left + 1
+	}
+	return right + 1
+}
+
+var bucketSizes = []int{0, 4, 16, 64}
+
+func BenchmarkTreeBuildBuckets(b *testing.B) {
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 300; i++ {
+		for j := 0; j < 300; j++ {
+			point := Point{
+				Lat:  float64(i),
+				Lon:  float64(j),
+				Date: 0}
+			points = append(points, &point)
+		}
+	}
+
+	for _, size := range bucketSizes {
+		b.Run(fmt.Sprintf("MaxChildren=%d", size), func(b *testing.B) {
+			var distancer PointDistancer
+			var tree VPTree
+			tree.Distancer = &distancer
+			tree.MaxChildren = size
+
+			for i := 0; i < b.N; i++ {
+				tree.SetItems(points)
+			}
+			b.ReportMetric(float64(vpTreeDepth(tree.tree.root)), "depth")
+		})
+	}
+}
+
+func BenchmarkTreeSearchBuckets(b *testing.B) {
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 300; i++ {
+		for j := 0; j < 300; j++ {
+			point := Point{
+				Lat:  float64(i) / 3,
+				Lon:  float64(j) / 3,
+				Date: i + j}
+			points = append(points, &point)
+		}
+	}
+
+	for _, size := range bucketSizes {
+		b.Run(fmt.Sprintf("MaxChildren=%d", size), func(b *testing.B) {
+			var distancer PointDistancer
+			var tree VPTree
+			tree.Distancer = &distancer
+			tree.MaxChildren = size
+			tree.SetItems(points)
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				p := Point{
+					Lat:  rand.Float64() * 100.0,
+					Lon:  rand.Float64() * 100.0,
+					Date: i}
+				tree.Search(&p, 10)
+			}
+			b.ReportMetric(float64(vpTreeDepth(tree.tree.root)), "depth")
+		})
+	}
+}
+
+// BenchmarkTreeSearchApproximate reports recall@k of approximate searches
+// against the exact results along with their latency
+func BenchmarkTreeSearchApproximate(b *testing.B) {
+	points := make([]VPTreeItem, 0)
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 100; j++ {
+			points = append(points, &Point{
+				Lat: float64(i) + rand.Float64(),
+				Lon: float64(j) + rand.Float64()})
+		}
+	}
+
+	var distancer PointDistancer
+	var tree VPTree
+	tree.Distancer = &distancer
+	tree.MaxChildren = 8
+	tree.SetItems(points)
+
+	const k = 10
+	targets := make([]VPTreeItem, 1000)
+	exact := make([]map[VPTreeItem]bool, len(targets))
+	for i := range targets {
+		targets[i] = &Point{
+			Lat: rand.Float64() * 100.0,
+			Lon: rand.Float64() * 100.0}
+		results, _ := tree.Search(targets[i], k)
+		exact[i] = make(map[VPTreeItem]bool, k)
+		for _, r := range results {
+			exact[i][r] = true
+		}
+	}
+
+	options := []SearchOptions[VPTreeItem]{
+		{},
+		{Epsilon: 0.1},
+		{Epsilon: 0.5},
+		{Epsilon: 1},
+		{MaxVisited: 50},
+		{MaxVisited: 20},
+	}
+	for _, opts := range options {
+		name := fmt.Sprintf("eps=%v/visited=%d", opts.Epsilon, opts.MaxVisited)
+		b.Run(name, func(b *testing.B) {
+			found, total := 0, 0
+			for i := 0; i < b.N; i++ {
+				idx := i % len(targets)
+				results, _, _ := tree.SearchContext(context.Background(), targets[idx], k, opts)
+				for _, r := range results {
+					if exact[idx][r] {
+						found++
+					}
+				}
+				total += k
+			}
+			b.ReportMetric(float64(found)/float64(total), "recall")
+		})
+	}
+}